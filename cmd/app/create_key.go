@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/app/service"
+	"kazokku/internal/domain"
+	"log/slog"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// createKey stores a new bearer API key and prints its plaintext, which is
+// not shown again. It bootstraps the first administrator key, which then
+// manages the others through /admin/api-keys.
+//
+// With -legacy it stores the key set in API_KEY_LEGACY instead, the one
+// formerly compiled into the binary, limited to reading users.
+func createKey(ctx context.Context, db *pgxpool.Pool, legacyKey string, logger *slog.Logger, args []string) {
+	flags := flag.NewFlagSet("create-key", flag.ExitOnError)
+	name := flags.String("name", "admin", "name of the key")
+	owner := flags.String("owner", "", "who the key is issued to")
+	role := flags.String("role", domain.RoleAdmin, "role the key is bound to (admin, support or auditor)")
+	legacy := flags.Bool("legacy", false, "store API_KEY_LEGACY as a read-only key instead of generating one")
+	flags.Parse(args)
+
+	data := dto.ApiKeyRequest{Name: *name, Owner: *owner, Role: *role}
+	var plaintext string
+	if *legacy {
+		if legacyKey == "" {
+			logger.Error("API_KEY_LEGACY must be set to import the legacy key")
+			os.Exit(1)
+		}
+		data.Role = domain.RoleAuditor
+		data.Scopes = []string{domain.ScopeUsersRead}
+		plaintext = legacyKey
+	}
+
+	id, key, err := service.IssueApiKey(ctx, db, repository.NewApiKeyRepository(db), repository.NewAuditRepository(db), data, plaintext)
+	if err != nil {
+		logger.Error("failed to create api key", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("api key created", "key_id", id, "role", data.Role)
+	if !*legacy {
+		fmt.Println(key)
+	}
+}
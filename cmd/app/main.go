@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/app/service"
+	"kazokku/internal/infrastructure/cardbrand"
 	"kazokku/internal/infrastructure/database"
+	"kazokku/internal/infrastructure/envelope"
 	"kazokku/internal/infrastructure/http"
+	"kazokku/internal/infrastructure/ratelimit"
 	"kazokku/internal/utils"
 	"log/slog"
 	"os"
@@ -35,7 +40,60 @@ func main() {
 		os.Exit(1)
 	}
 
-	app := http.New(conf.App, db, logger)
+	keys, err := envelope.New(conf.Card)
+	if err != nil {
+		logger.Error("failed to load card master keys", "error", err)
+		os.Exit(1)
+	}
+
+	brands, err := cardbrand.New(conf.Card)
+	if err != nil {
+		logger.Error("failed to load card BIN ranges", "error", err)
+		os.Exit(1)
+	}
+
+	// every card must be in the vault before it is read or rotated
+	vault := service.NewCardVault(keys, brands, repository.NewVaultRepository(db))
+	cardTokenizer := service.NewCardTokenizer(db, logger, keys, vault, repository.NewCreditCardRepository(db))
+	if err := cardTokenizer.Run(ctx); err != nil {
+		logger.Error("failed to move credit cards to the vault", "error", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(ctx, db, keys, logger, os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "create-key" {
+		createKey(ctx, db, conf.App.ApiKeyLegacy, logger, os.Args[2:])
+		return
+	}
+
+	purger := service.NewUserPurger(db, logger, conf.Purge.Retention, conf.Purge.Interval, repository.NewUserRepository(db), repository.NewCreditCardRepository(db), repository.NewPhotoRepository(db), repository.NewAuditRepository(db), vault)
+	go purger.Run(ctx)
+
+	noncePurger := service.NewNoncePurger(logger, conf.App.NoncePurgeInterval, repository.NewNonceRepository(db))
+	go noncePurger.Run(ctx)
+
+	if conf.Audit.StreamFile != "" {
+		auditStreamer := service.NewAuditStreamer(logger, conf.Audit.StreamFile, conf.Audit.StreamInterval, repository.NewAuditRepository(db))
+		go auditStreamer.Run(ctx)
+	}
+
+	limiter, err := ratelimit.New(conf.RateLimit, db, logger)
+	if err != nil {
+		logger.Error("failed to create rate limiter", "error", err)
+		os.Exit(1)
+	}
+	go limiter.Run(ctx)
+
+	app, err := http.New(conf, db, limiter, keys, brands, logger)
+	if err != nil {
+		logger.Error("failed to create app", "error", err)
+		os.Exit(1)
+	}
+
 	if err := app.Run(); err != nil {
 		logger.Error("failed to start app", "error", err)
 		os.Exit(1)
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/app/service"
+	"kazokku/internal/infrastructure/envelope"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// rotateKeys moves the card vault to the current card master key. It
+// can be stopped at any time and picks up where it stopped on the next run.
+func rotateKeys(ctx context.Context, db *pgxpool.Pool, keys envelope.Keyring, logger *slog.Logger, args []string) {
+	flags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	batch := flags.Int("batch", 100, "number of vault entries rotated per transaction")
+	flags.Parse(args)
+
+	if *batch < 1 {
+		logger.Error("batch must be at least 1")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rotator := service.NewKeyRotator(db, logger, keys, *batch, repository.NewVaultRepository(db), repository.NewKeyRotationRepository(db))
+	if err := rotator.Run(ctx); err != nil {
+		logger.Error("failed to rotate card keys", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,90 @@
+package dto
+
+import (
+	"kazokku/internal/domain"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type ApiKeyRequest struct {
+	Name      string   `json:"name" form:"name"`
+	Owner     string   `json:"owner" form:"owner"`
+	Scopes    []string `json:"scopes" form:"scopes"`
+	Role      string   `json:"role" form:"role"`
+	AuthMode  string   `json:"auth_mode" form:"auth_mode"`
+	ExpiresAt string   `json:"expires_at" form:"expires_at"`
+}
+
+type ApiKeyScopesRequest struct {
+	Scopes []string `json:"scopes" form:"scopes"`
+}
+
+type ApiKeyRoleRequest struct {
+	Role string `json:"role" form:"role"`
+}
+
+type ApiKeyResponse struct {
+	ID         uint       `json:"key_id"`
+	Name       string     `json:"name"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes"`
+	Role       string     `json:"role"`
+	AuthMode   string     `json:"auth_mode"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// ApiKeySecretResponse carries the plaintext key, or the signing secret of
+// keys in hmac mode, which is only ever returned by the request that created
+// or rotated it.
+type ApiKeySecretResponse struct {
+	ID     uint   `json:"key_id"`
+	Key    string `json:"key,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+func (r ApiKeyRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&r.Owner, validation.Required, validation.Length(1, 100)),
+		validation.Field(&r.Scopes, validation.Each(validScope, allowedScope(r.Role))),
+		validation.Field(&r.Role, validation.Required, validRole),
+		validation.Field(&r.AuthMode, validation.In(domain.AuthModeBearer, domain.AuthModeHMAC)),
+		validation.Field(&r.ExpiresAt, validation.Date(time.RFC3339)),
+	)
+}
+
+func (r ApiKeyScopesRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Scopes, validation.Required, validation.Each(validScope)),
+	)
+}
+
+func (r ApiKeyRoleRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Role, validation.Required, validRole),
+	)
+}
+
+var (
+	validScope = validation.NewStringRule(func(s string) bool {
+		return slices.Contains(domain.Scopes, s)
+	}, "invalid scope (valid values are "+strings.Join(domain.Scopes, ", ")+")")
+
+	validRole = validation.NewStringRule(func(s string) bool {
+		return slices.Contains(domain.Roles, s)
+	}, "invalid role (valid values are "+strings.Join(domain.Roles, ", ")+")")
+)
+
+// allowedScope rejects scopes beyond what role allows.
+func allowedScope(role string) validation.Rule {
+	return validation.NewStringRule(func(s string) bool {
+		return domain.RoleAllows(role, s)
+	}, "scope not allowed for role "+role)
+}
@@ -0,0 +1,44 @@
+package dto
+
+import (
+	"kazokku/internal/domain"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type AuditQuery struct {
+	ActorType  string `query:"actor_type"`
+	ActorID    uint   `query:"actor_id"`
+	Action     string `query:"action"`
+	TargetType string `query:"target_type"`
+	TargetID   uint   `query:"target_id"`
+	RequestID  string `query:"request_id"`
+	From       string `query:"from"`
+	To         string `query:"to"`
+	Offset     int    `query:"of"`
+	Limit      int    `query:"lt"`
+}
+
+type AuditEventResponse struct {
+	ID         uint                  `json:"id"`
+	ActorType  string                `json:"actor_type"`
+	ActorID    *uint                 `json:"actor_id"`
+	RequestID  string                `json:"request_id"`
+	IP         string                `json:"ip"`
+	Action     string                `json:"action"`
+	TargetType string                `json:"target_type"`
+	TargetID   uint                  `json:"target_id"`
+	Changes    []FieldChangeResponse `json:"changes"`
+	CreatedAt  time.Time             `json:"created_at"`
+}
+
+func (q AuditQuery) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.ActorType, validation.In(domain.ActorApiKey, domain.ActorUser, domain.ActorAnonymous, domain.ActorSystem)),
+		validation.Field(&q.From, validation.Date(time.RFC3339)),
+		validation.Field(&q.To, validation.Date(time.RFC3339)),
+		validation.Field(&q.Offset, validation.Min(0)),
+		validation.Field(&q.Limit, validation.Min(0), validation.Max(1000)),
+	)
+}
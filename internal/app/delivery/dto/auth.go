@@ -0,0 +1,83 @@
+package dto
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+type LoginRequest struct {
+	Email    string `json:"email" form:"email"`
+	Password string `json:"password" form:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" form:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" form:"token"`
+	Password string `json:"password" form:"password"`
+}
+
+// TokenResponse carries the tokens of a new session. A login that still
+// needs a second factor returns only MFAToken and the flag saying which step
+// it is for.
+type TokenResponse struct {
+	AccessToken          string   `json:"access_token,omitempty"`
+	TokenType            string   `json:"token_type,omitempty"`
+	ExpiresIn            int64    `json:"expires_in,omitempty"`
+	RefreshToken         string   `json:"refresh_token,omitempty"`
+	MFARequired          bool     `json:"mfa_required,omitempty"`
+	MFAEnrolmentRequired bool     `json:"mfa_enrolment_required,omitempty"`
+	MFAToken             string   `json:"mfa_token,omitempty"`
+	RecoveryCodes        []string `json:"recovery_codes,omitempty"`
+}
+
+type SessionResponse struct {
+	ID         uint      `json:"session_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (r LoginRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Email, validation.Required, is.Email),
+		validation.Field(&r.Password, validation.Required),
+	)
+}
+
+func (r RefreshRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.RefreshToken, validation.Required),
+	)
+}
+
+func (r ForgotPasswordRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Email, validation.Required, is.Email),
+	)
+}
+
+func (r ResetPasswordRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Token, validation.Required),
+		validation.Field(&r.Password, validation.Required),
+	)
+}
+
+// ValidatePassword applies the password policy rule to the new password.
+func (r ResetPasswordRequest) ValidatePassword(policy validation.Rule) error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Password, policy),
+	)
+}
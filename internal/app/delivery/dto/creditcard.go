@@ -1,8 +1,60 @@
 package dto
 
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// CardBrands supplies the rules that check a card against the brand its
+// number belongs to.
+type CardBrands interface {
+	TypeRule() validation.Rule
+	NumberRule(cardType string) validation.Rule
+	CVVRule(pan string) validation.Rule
+}
+
+type CreditCardRequest struct {
+	UserID  uint   `json:"-" form:"-"`
+	CardID  uint   `json:"-" form:"-"`
+	Type    string `json:"type" form:"type"`
+	Number  string `json:"number" form:"number"`
+	Name    string `json:"name" form:"name"`
+	Expired string `json:"expired" form:"expired"`
+	CVV     string `json:"cvv" form:"cvv"`
+	Default bool   `json:"default" form:"default"`
+}
+
 type CreditCardResponse struct {
-	Type    string `json:"type"`
-	Number  string `json:"number"`
-	Name    string `json:"name"`
-	Expired string `json:"expired"`
+	ID        uint      `json:"card_id"`
+	Type      string    `json:"type"`
+	Number    string    `json:"number"`
+	Name      string    `json:"name"`
+	Expired   string    `json:"expired"`
+	Default   bool      `json:"default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ValidateCreate checks a new card. The type may be left out, it is then
+// taken from the number.
+func (r CreditCardRequest) ValidateCreate(brands CardBrands) error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Type, brands.TypeRule()),
+		validation.Field(&r.Number, validation.Required, brands.NumberRule(r.Type)),
+		validation.Field(&r.Name, validation.Required),
+		validation.Field(&r.Expired, validation.Required, validCCExpDate),
+		validation.Field(&r.CVV, validation.Required, brands.CVVRule(r.Number)),
+	)
+}
+
+func (r CreditCardRequest) ValidateUpdate(brands CardBrands) error {
+	return validation.ValidateStruct(&r,
+		// the type follows from the number, so it only changes with it
+		validation.Field(&r.Type, validation.When(r.Number != "", brands.TypeRule()).Else(validCCTypeAlone)),
+		validation.Field(&r.Number, brands.NumberRule(r.Type)),
+		validation.Field(&r.Expired, validCCExpDate),
+		// the CVV is only checked along with the number it belongs to
+		validation.Field(&r.CVV, validation.When(r.Number != "", validation.Required, brands.CVVRule(r.Number)).Else(validation.Empty)),
+	)
 }
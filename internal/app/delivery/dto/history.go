@@ -0,0 +1,33 @@
+package dto
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type HistoryQuery struct {
+	Offset int `query:"of"`
+	Limit  int `query:"lt"`
+}
+
+type FieldChangeResponse struct {
+	Field string  `json:"field"`
+	Old   *string `json:"old"`
+	New   *string `json:"new"`
+}
+
+type HistoryResponse struct {
+	Version   uint                  `json:"version"`
+	Changes   []FieldChangeResponse `json:"changes"`
+	ActorType string                `json:"actor_type,omitempty"`
+	ActorID   *uint                 `json:"actor_id,omitempty"`
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+func (q HistoryQuery) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Offset, validation.Min(0)),
+		validation.Field(&q.Limit, validation.Min(0)),
+	)
+}
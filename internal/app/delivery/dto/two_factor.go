@@ -0,0 +1,62 @@
+package dto
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+type TOTPEnrolmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	QRCode string `json:"qr_code"`
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code" form:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" form:"mfa_token"`
+	Code         string `json:"code" form:"code"`
+	RecoveryCode string `json:"recovery_code" form:"recovery_code"`
+}
+
+type MFAEnrolRequest struct {
+	MFAToken string `json:"mfa_token" form:"mfa_token"`
+}
+
+type MFAConfirmRequest struct {
+	MFAToken string `json:"mfa_token" form:"mfa_token"`
+	Code     string `json:"code" form:"code"`
+}
+
+func (r TOTPConfirmRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Code, validation.Required, validation.Length(6, 6), is.Digit),
+	)
+}
+
+func (r MFAVerifyRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.MFAToken, validation.Required),
+		validation.Field(&r.Code, validation.When(r.RecoveryCode == "", validation.Required), validation.Length(6, 6), is.Digit),
+		validation.Field(&r.RecoveryCode, validation.Length(0, 32)),
+	)
+}
+
+func (r MFAEnrolRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.MFAToken, validation.Required),
+	)
+}
+
+func (r MFAConfirmRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.MFAToken, validation.Required),
+		validation.Field(&r.Code, validation.Required, validation.Length(6, 6), is.Digit),
+	)
+}
@@ -10,6 +10,7 @@ import (
 
 type UserRequest struct {
 	UserID            uint   `json:"user_id" form:"user_id"`
+	Version           uint   `json:"-" form:"-"`
 	Name              string `json:"name" form:"name"`
 	Address           string `json:"address" form:"address"`
 	Email             string `json:"email" form:"email"`
@@ -21,28 +22,60 @@ type UserRequest struct {
 	CreditCardCVV     string `json:"creditcard_cvv" form:"creditcard_cvv"`
 }
 
+type UserPatchRequest struct {
+	UserID      uint
+	Version     uint
+	ContentType string
+	Patch       []byte
+}
+
+// UserPatchDocument is the representation of a user that JSON Patch and JSON
+// Merge Patch documents are applied to. Secrets are write-only and therefore
+// absent from it.
+type UserPatchDocument struct {
+	Name              string `json:"name"`
+	Address           string `json:"address"`
+	Email             string `json:"email"`
+	CreditCardType    string `json:"creditcard_type"`
+	CreditCardName    string `json:"creditcard_name"`
+	CreditCardExpired string `json:"creditcard_expired"`
+}
+
 type UserQuery struct {
-	Query   string `query:"q"`
-	OrderBy string `query:"ob"`
-	SortBy  string `query:"sb"`
-	Offset  int    `query:"of"`
-	Limit   int    `query:"lt"`
+	Query       string `query:"q"`
+	OrderBy     string `query:"ob"`
+	SortBy      string `query:"sb"`
+	Offset      int    `query:"of"`
+	Limit       int    `query:"lt"`
+	CreatedFrom string `query:"created_from"`
+	CreatedTo   string `query:"created_to"`
 }
 
 type UserResponse struct {
-	ID         uint               `json:"user_id"`
-	Name       string             `json:"name"`
-	Email      string             `json:"email"`
-	Address    string             `json:"address"`
-	Photos     []string           `json:"photos"`
-	CreditCard CreditCardResponse `json:"creditcard"`
+	ID              uint                 `json:"user_id"`
+	Version         uint                 `json:"version"`
+	Name            string               `json:"name"`
+	Email           string               `json:"email"`
+	Address         string               `json:"address"`
+	Photos          []PhotoResponse      `json:"photos"`
+	CreditCard      *CreditCardResponse  `json:"creditcard,omitempty"`
+	CreditCards     []CreditCardResponse `json:"creditcards,omitempty"`
+	EmailVerifiedAt *time.Time           `json:"email_verified_at"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+}
+
+type PhotoResponse struct {
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ConfirmEmailRequest struct {
+	Token string `json:"token" form:"token"`
 }
 
 var (
-	validCCType = validation.NewStringRule(func(s string) bool {
-		lowerS := strings.ToLower(s)
-		return lowerS == "visa" || lowerS == "mastercard" || lowerS == "amex" || lowerS == "american express" || lowerS == "discover"
-	}, "invalid credit card type (only visa, mastercard, american express/amex, discover))")
+	validCCTypeAlone = validation.Empty.ErrorObject(validation.NewError("validation_card_type_alone", "can only change along with the card number"))
 
 	validCCExpDate = validation.NewStringRule(func(s string) bool {
 		if len(s) != 5 {
@@ -63,8 +96,8 @@ var (
 
 	validOrderBy = validation.NewStringRule(func(s string) bool {
 		lowerS := strings.ToLower(s)
-		return lowerS == "name" || lowerS == "email"
-	}, "invalid order by (valid values are name, email)")
+		return lowerS == "name" || lowerS == "email" || lowerS == "created_at" || lowerS == "updated_at"
+	}, "invalid order by (valid values are name, email, created_at, updated_at)")
 
 	validSortBy = validation.NewStringRule(func(s string) bool {
 		lowerS := strings.ToLower(s)
@@ -78,7 +111,6 @@ func (r UserRequest) ValidateRegister() error {
 		validation.Field(&r.Email, validation.Required, is.Email),
 		validation.Field(&r.Password, validation.Required),
 		validation.Field(&r.Address, validation.Required),
-		validation.Field(&r.CreditCardType, validation.Required),
 		validation.Field(&r.CreditCardNumber, validation.Required),
 		validation.Field(&r.CreditCardName, validation.Required),
 		validation.Field(&r.CreditCardExpired, validation.Required),
@@ -86,13 +118,22 @@ func (r UserRequest) ValidateRegister() error {
 	)
 }
 
-func (r UserRequest) ValidateCreditCardRegister() error {
+// ValidatePassword applies the password policy rule to a new password.
+func (r UserRequest) ValidatePassword(policy validation.Rule) error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Password, policy),
+	)
+}
+
+// ValidateCreditCardRegister checks the first card. The type may be left
+// out, it is then taken from the number.
+func (r UserRequest) ValidateCreditCardRegister(brands CardBrands) error {
 	return validation.ValidateStruct(&r,
-		validation.Field(&r.CreditCardType, validation.Required, validCCType),
-		validation.Field(&r.CreditCardNumber, validation.Required, is.CreditCard),
+		validation.Field(&r.CreditCardType, brands.TypeRule()),
+		validation.Field(&r.CreditCardNumber, validation.Required, brands.NumberRule(r.CreditCardType)),
 		validation.Field(&r.CreditCardName, validation.Required),
 		validation.Field(&r.CreditCardExpired, validation.Required, validCCExpDate),
-		validation.Field(&r.CreditCardCVV, validation.Required, validation.Length(3, 4), is.UTFNumeric),
+		validation.Field(&r.CreditCardCVV, validation.Required, brands.CVVRule(r.CreditCardNumber)),
 	)
 }
 
@@ -103,12 +144,35 @@ func (r UserRequest) ValidateUpdate() error {
 	)
 }
 
-func (r UserRequest) ValidateCreditCardUpdate() error {
+// ValidatePatch checks the user after a patch was applied. Only what is
+// required on registration has to stay set: the address can be cleared,
+// the name, the email and the card name and expiry can not. The card type
+// is taken from the number when it is left out. A user whose last card was
+// deleted has no card fields to keep, hasCard tells whether there is one.
+func (r UserRequest) ValidatePatch(hasCard bool) error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.UserID, validation.Required),
+		validation.Field(&r.Name, validation.Required),
+		validation.Field(&r.Email, validation.Required, is.Email),
+		validation.Field(&r.CreditCardName, validation.When(hasCard, validation.Required)),
+		validation.Field(&r.CreditCardExpired, validation.When(hasCard, validation.Required)),
+	)
+}
+
+func (r UserRequest) ValidateCreditCardUpdate(brands CardBrands) error {
 	return validation.ValidateStruct(&r,
-		validation.Field(&r.CreditCardType, validCCType),
-		validation.Field(&r.CreditCardNumber, is.CreditCard),
+		// the type follows from the number, so it only changes with it
+		validation.Field(&r.CreditCardType, validation.When(r.CreditCardNumber != "", brands.TypeRule()).Else(validCCTypeAlone)),
+		validation.Field(&r.CreditCardNumber, brands.NumberRule(r.CreditCardType)),
 		validation.Field(&r.CreditCardExpired, validCCExpDate),
-		validation.Field(&r.CreditCardCVV, validation.Length(3, 4), is.UTFNumeric),
+		// the CVV is only checked along with the number it belongs to
+		validation.Field(&r.CreditCardCVV, validation.When(r.CreditCardNumber != "", validation.Required, brands.CVVRule(r.CreditCardNumber)).Else(validation.Empty)),
+	)
+}
+
+func (r ConfirmEmailRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Token, validation.Required),
 	)
 }
 
@@ -118,5 +182,7 @@ func (q UserQuery) Validate() error {
 		validation.Field(&q.Limit, validation.Min(0)),
 		validation.Field(&q.OrderBy, validOrderBy),
 		validation.Field(&q.SortBy, validSortBy),
+		validation.Field(&q.CreatedFrom, validation.Date(time.RFC3339)),
+		validation.Field(&q.CreatedTo, validation.Date(time.RFC3339)),
 	)
 }
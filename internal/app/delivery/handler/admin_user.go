@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"kazokku/internal/app/service"
+	"kazokku/internal/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type adminUserHandler struct {
+	lockoutService   service.LockoutService
+	twoFactorService service.TwoFactorService
+}
+
+func NewAdminUserHandler(lockoutService service.LockoutService, twoFactorService service.TwoFactorService) adminUserHandler {
+	return adminUserHandler{lockoutService, twoFactorService}
+}
+
+func (h adminUserHandler) Unlock(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.lockoutService.Unlock(ctx, uint(userID)); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h adminUserHandler) ResetTwoFactor(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.twoFactorService.Reset(ctx, uint(userID)); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/service"
+	"kazokku/internal/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type apiKeyHandler struct {
+	apiKeyService service.ApiKeyService
+}
+
+func NewApiKeyHandler(apiKeyService service.ApiKeyService) apiKeyHandler {
+	return apiKeyHandler{apiKeyService}
+}
+
+func (h apiKeyHandler) Create(ctx *fiber.Ctx) error {
+	var data dto.ApiKeyRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.apiKeyService.Create(ctx, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h apiKeyHandler) GetAll(ctx *fiber.Ctx) error {
+	keys, err := h.apiKeyService.GetAll(ctx)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"count": len(keys),
+		"rows":  keys,
+	})
+}
+
+func (h apiKeyHandler) Rotate(ctx *fiber.Ctx) error {
+	keyID, err := ctx.ParamsInt("key_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.apiKeyService.Rotate(ctx, uint(keyID))
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h apiKeyHandler) UpdateScopes(ctx *fiber.Ctx) error {
+	keyID, err := ctx.ParamsInt("key_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var data dto.ApiKeyScopesRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.apiKeyService.UpdateScopes(ctx, uint(keyID), data); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h apiKeyHandler) UpdateRole(ctx *fiber.Ctx) error {
+	keyID, err := ctx.ParamsInt("key_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var data dto.ApiKeyRoleRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.apiKeyService.UpdateRole(ctx, uint(keyID), data); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h apiKeyHandler) Revoke(ctx *fiber.Ctx) error {
+	keyID, err := ctx.ParamsInt("key_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.apiKeyService.Revoke(ctx, uint(keyID)); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
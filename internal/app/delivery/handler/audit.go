@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/service"
+	"kazokku/internal/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type auditHandler struct {
+	auditService service.AuditService
+}
+
+func NewAuditHandler(auditService service.AuditService) auditHandler {
+	return auditHandler{auditService}
+}
+
+func (h auditHandler) GetAll(ctx *fiber.Ctx) error {
+	var query dto.AuditQuery
+	if err := ctx.QueryParser(&query); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	events, err := h.auditService.GetAll(ctx, query)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"count": len(events),
+		"rows":  events,
+	})
+}
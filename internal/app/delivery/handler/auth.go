@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/service"
+	"kazokku/internal/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type authHandler struct {
+	authService service.AuthService
+}
+
+func NewAuthHandler(authService service.AuthService) authHandler {
+	return authHandler{authService}
+}
+
+func (h authHandler) Login(ctx *fiber.Ctx) error {
+	var data dto.LoginRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.authService.Login(ctx, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h authHandler) Refresh(ctx *fiber.Ctx) error {
+	var data dto.RefreshRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.authService.Refresh(ctx, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h authHandler) Logout(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(uint)
+	sessionID, _ := ctx.Locals("session_id").(uint)
+
+	if err := h.authService.Logout(ctx, userID, sessionID); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h authHandler) GetSessions(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(uint)
+	sessionID, _ := ctx.Locals("session_id").(uint)
+
+	sessions, err := h.authService.GetSessions(ctx, userID, sessionID)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"count": len(sessions),
+		"rows":  sessions,
+	})
+}
+
+func (h authHandler) RevokeSession(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(uint)
+	sessionID, err := ctx.ParamsInt("session_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.authService.RevokeSession(ctx, userID, uint(sessionID)); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h authHandler) ForgotPassword(ctx *fiber.Ctx) error {
+	var data dto.ForgotPasswordRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.authService.ForgotPassword(ctx, data); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h authHandler) ResetPassword(ctx *fiber.Ctx) error {
+	var data dto.ResetPasswordRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.authService.ResetPassword(ctx, data); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h authHandler) VerifyMFA(ctx *fiber.Ctx) error {
+	var data dto.MFAVerifyRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.authService.VerifyMFA(ctx, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h authHandler) EnrolMFA(ctx *fiber.Ctx) error {
+	var data dto.MFAEnrolRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.authService.EnrolMFA(ctx, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h authHandler) ConfirmMFA(ctx *fiber.Ctx) error {
+	var data dto.MFAConfirmRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.authService.ConfirmMFA(ctx, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/service"
+	"kazokku/internal/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type creditCardHandler struct {
+	ccService service.CreditCardService
+}
+
+func NewCreditCardHandler(ccService service.CreditCardService) creditCardHandler {
+	return creditCardHandler{ccService}
+}
+
+func (h creditCardHandler) GetAll(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	cards, err := h.ccService.GetAll(ctx, uint(userID))
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"count": len(cards),
+		"rows":  cards,
+	})
+}
+
+func (h creditCardHandler) Create(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var data dto.CreditCardRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	data.UserID = uint(userID)
+
+	id, err := h.ccService.Create(ctx, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"card_id": id,
+	})
+}
+
+func (h creditCardHandler) UpdateByID(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	cardID, err := ctx.ParamsInt("card_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var data dto.CreditCardRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	data.UserID = uint(userID)
+	data.CardID = uint(cardID)
+
+	if err := h.ccService.UpdateByID(ctx, data); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h creditCardHandler) DeleteByID(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	cardID, err := ctx.ParamsInt("card_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.ccService.DeleteByID(ctx, uint(userID), uint(cardID)); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
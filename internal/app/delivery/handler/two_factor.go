@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/service"
+	"kazokku/internal/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type twoFactorHandler struct {
+	twoFactorService service.TwoFactorService
+}
+
+func NewTwoFactorHandler(twoFactorService service.TwoFactorService) twoFactorHandler {
+	return twoFactorHandler{twoFactorService}
+}
+
+func (h twoFactorHandler) Enrol(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(uint)
+
+	resp, err := h.twoFactorService.Enrol(ctx, userID)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h twoFactorHandler) Confirm(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(uint)
+	var data dto.TOTPConfirmRequest
+	if err := ctx.BodyParser(&data); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp, err := h.twoFactorService.Confirm(ctx, userID, data)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(resp)
+}
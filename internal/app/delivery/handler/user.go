@@ -10,11 +10,12 @@ import (
 )
 
 type userHandler struct {
-	userService service.UserService
+	userService    service.UserService
+	requireIfMatch bool
 }
 
-func NewUserHandler(userService service.UserService) userHandler {
-	return userHandler{userService}
+func NewUserHandler(userService service.UserService, requireIfMatch bool) userHandler {
+	return userHandler{userService, requireIfMatch}
 }
 
 func (h userHandler) Register(ctx *fiber.Ctx) error {
@@ -103,18 +104,178 @@ func (h userHandler) GetByID(ctx *fiber.Ctx) error {
 		})
 	}
 
+	ctx.Set(fiber.HeaderETag, helpers.FormatETag(user.Version))
 	return ctx.Status(fiber.StatusOK).JSON(user)
 }
 
 func (h userHandler) UpdateByID(ctx *fiber.Ctx) error {
-	var data dto.UserRequest
+	var version uint
+	if ifMatch := ctx.Get(fiber.HeaderIfMatch); ifMatch != "" {
+		var err error
+		version, err = helpers.ParseETag(ifMatch)
+		if err != nil {
+			return ctx.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	} else if h.requireIfMatch {
+		return ctx.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+			"error": helpers.ErrPreconditionRequired.Error(),
+		})
+	}
+
+	var err error
+	if contentType := ctx.Get(fiber.HeaderContentType); helpers.IsPatchContentType(contentType) {
+		userID, paramErr := ctx.ParamsInt("user_id")
+		if paramErr != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Please provide user_id in the path.",
+			})
+		}
+
+		version, err = h.userService.PatchByID(ctx, dto.UserPatchRequest{
+			UserID:      uint(userID),
+			Version:     version,
+			ContentType: contentType,
+			Patch:       ctx.Body(),
+		})
+	} else {
+		var data dto.UserRequest
+		if err := ctx.BodyParser(&data); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if userID, paramErr := ctx.ParamsInt("user_id"); paramErr == nil {
+			data.UserID = uint(userID)
+		}
+		data.Version = version
+
+		version, err = h.userService.UpdateByID(ctx, data)
+	}
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx.Set(fiber.HeaderETag, helpers.FormatETag(version))
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h userHandler) DeleteByID(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.userService.DeleteByID(ctx, uint(userID)); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h userHandler) RestoreByID(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.userService.RestoreByID(ctx, uint(userID)); err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func (h userHandler) GetHistory(ctx *fiber.Ctx) error {
+	userID, err := ctx.ParamsInt("user_id")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var query dto.HistoryQuery
+	if err := ctx.QueryParser(&query); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	history, err := h.userService.GetHistory(ctx, uint(userID), query)
+	if err != nil {
+		var respErr helpers.ResponseError
+		if errors.As(err, &respErr) {
+			var validationErr helpers.ValidationError
+			if errors.As(respErr.Unwrap(), &validationErr) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"errors": validationErr.ErrSlice(),
+				})
+			}
+			return ctx.Status(respErr.Code()).JSON(fiber.Map{
+				"error": respErr.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"count": len(history),
+		"rows":  history,
+	})
+}
+
+func (h userHandler) ConfirmEmail(ctx *fiber.Ctx) error {
+	var data dto.ConfirmEmailRequest
 	if err := ctx.BodyParser(&data); err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	if err := h.userService.UpdateByID(ctx, data); err != nil {
+	if err := h.userService.ConfirmEmail(ctx, data); err != nil {
 		var respErr helpers.ResponseError
 		if errors.As(err, &respErr) {
 			var validationErr helpers.ValidationError
@@ -1,18 +1,145 @@
 package middleware
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"strconv"
+	"time"
 
-func ApiKey() func(*fiber.Ctx) error {
+	"github.com/gofiber/fiber/v2"
+)
+
+// ApiKeyAuth holds what is needed to authenticate API key requests, sent
+// either with the plain key header or signed with KAZOKKU-HMAC.
+type ApiKeyAuth struct {
+	Keys       repository.ApiKeyRepository
+	Nonces     repository.NonceRepository
+	HMACSecret string
+	MaxSkew    time.Duration
+}
+
+// ApiKey requires an active API key that holds every one of scopes. Keys in
+// bearer mode are sent in the key header, keys in hmac mode must sign the
+// request. The key is stored in the api_key_id and principal locals.
+func ApiKey(auth ApiKeyAuth, scopes ...string) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
-		if apiKey := string(c.Request().Header.Peek("key")); apiKey == "" {
+		var key domain.ApiKey
+		var err error
+		if params, ok := helpers.ParseHMACAuthorization(c.Get(fiber.HeaderAuthorization)); ok {
+			key, err = auth.verifySignature(c, params)
+		} else if apiKey := string(c.Request().Header.Peek("key")); apiKey != "" {
+			key, err = auth.verifyKey(c, apiKey)
+		} else {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "API Key is missing.",
 			})
-		} else if apiKey != "HiJhvL$T27@1u^%u86g" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid API Key.",
+		}
+
+		if err != nil {
+			var respErr helpers.ResponseError
+			if errors.As(err, &respErr) {
+				return c.Status(respErr.Code()).JSON(fiber.Map{
+					"error": respErr.Error(),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": helpers.ErrInternal.Error(),
+			})
+		}
+
+		principal := domain.Principal{ApiKeyID: key.ID, Role: key.Role, Scopes: key.EffectiveScopes()}
+		if err := requireScopes(principal, scopes); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
 			})
 		}
+
+		// last_used_at is informational, a failed write must not reject the request
+		auth.Keys.Touch(c.Context(), key.ID)
+
+		c.Locals("api_key_id", key.ID)
+		c.Locals("principal", principal)
 		return c.Next()
 	}
 }
+
+func (auth ApiKeyAuth) verifyKey(c *fiber.Ctx, apiKey string) (domain.ApiKey, error) {
+	key, err := auth.Keys.GetByHash(c.Context(), helpers.HashToken(apiKey))
+	if err != nil && !errors.Is(err, helpers.ErrApiKeyNotFound) {
+		return key, err
+	}
+
+	if err != nil || !key.IsActive() {
+		return key, helpers.NewResponseError(errors.New("Invalid API Key."), fiber.StatusUnauthorized)
+	}
+
+	if key.AuthMode == domain.AuthModeHMAC {
+		return key, helpers.NewResponseError(errors.New("API Key requires signed requests."), fiber.StatusUnauthorized)
+	}
+
+	return key, nil
+}
+
+func (auth ApiKeyAuth) verifySignature(c *fiber.Ctx, params map[string]string) (domain.ApiKey, error) {
+	invalid := helpers.NewResponseError(errors.New("Invalid request signature."), fiber.StatusUnauthorized)
+
+	keyID, err := strconv.ParseUint(params["keyId"], 10, 64)
+	if err != nil {
+		return domain.ApiKey{}, invalid
+	}
+
+	timestamp, err := strconv.ParseInt(params["timestamp"], 10, 64)
+	if err != nil {
+		return domain.ApiKey{}, invalid
+	}
+
+	nonce, signature := params["nonce"], params["signature"]
+	if nonce == "" || len(nonce) > 64 || signature == "" {
+		return domain.ApiKey{}, invalid
+	}
+
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > auth.MaxSkew || skew < -auth.MaxSkew {
+		return domain.ApiKey{}, helpers.NewResponseError(errors.New("Request timestamp is outside the allowed window."), fiber.StatusUnauthorized)
+	}
+
+	key, err := auth.Keys.GetByID(c.Context(), uint(keyID))
+	if err != nil && !errors.Is(err, helpers.ErrApiKeyNotFound) {
+		return key, err
+	}
+
+	if err != nil || !key.IsActive() || key.AuthMode != domain.AuthModeHMAC || auth.HMACSecret == "" {
+		return key, invalid
+	}
+
+	secret := helpers.DeriveHMACSecret(auth.HMACSecret, key.HMACSalt)
+	expected := helpers.SignRequest(secret, c.Method(), c.OriginalURL(), timestamp, nonce, c.Body())
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return key, invalid
+	}
+
+	// a nonce only has to be remembered while its timestamp is acceptable
+	fresh, err := auth.Nonces.Insert(c.Context(), key.ID, nonce, time.Unix(timestamp, 0).Add(auth.MaxSkew))
+	if err != nil {
+		return key, err
+	}
+
+	if !fresh {
+		return key, helpers.NewResponseError(errors.New("Request nonce has already been used."), fiber.StatusUnauthorized)
+	}
+
+	return key, nil
+}
+
+func requireScopes(principal domain.Principal, scopes []string) error {
+	for _, scope := range scopes {
+		if !principal.HasScope(scope) {
+			return fmt.Errorf("Missing required scope %s.", scope)
+		}
+	}
+
+	return nil
+}
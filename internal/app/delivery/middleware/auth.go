@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/infrastructure/token"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserToken requires a user access token that belongs to an active session.
+func UserToken(tokens token.Manager, sessions repository.SessionRepository) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		bearer, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Access token is missing.",
+			})
+		}
+
+		claims, ok := verifyUserToken(c, tokens, sessions, bearer)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid access token.",
+			})
+		}
+
+		c.Locals("user_id", claims.UserID())
+		c.Locals("session_id", claims.SessionID)
+		c.Locals("principal", domain.Principal{UserID: claims.UserID(), Scopes: domain.SelfScopes})
+		return c.Next()
+	}
+}
+
+// ApiKeyOrSelf accepts either a valid API key holding scopes or a user
+// access token issued to the user named by the user_id route parameter.
+func ApiKeyOrSelf(tokens token.Manager, sessions repository.SessionRepository, auth ApiKeyAuth, scopes ...string) func(*fiber.Ctx) error {
+	apiKey := ApiKey(auth, scopes...)
+	return func(c *fiber.Ctx) error {
+		bearer, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok {
+			return apiKey(c)
+		}
+
+		claims, ok := verifyUserToken(c, tokens, sessions, bearer)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid access token.",
+			})
+		}
+
+		if userID, err := c.ParamsInt("user_id"); err != nil || uint(userID) != claims.UserID() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access token does not grant access to this user.",
+			})
+		}
+
+		principal := domain.Principal{UserID: claims.UserID(), Scopes: domain.SelfScopes}
+		if err := requireScopes(principal, scopes); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		c.Locals("user_id", claims.UserID())
+		c.Locals("session_id", claims.SessionID)
+		c.Locals("principal", principal)
+		return c.Next()
+	}
+}
+
+func verifyUserToken(c *fiber.Ctx, tokens token.Manager, sessions repository.SessionRepository, bearer string) (token.Claims, bool) {
+	claims, err := tokens.Parse(bearer)
+	if err != nil {
+		return claims, false
+	}
+
+	session, err := sessions.GetByID(c.Context(), claims.SessionID)
+	if err != nil || session.UserID != claims.UserID() || !session.IsActive() {
+		return claims, false
+	}
+
+	return claims, true
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"kazokku/internal/infrastructure/ratelimit"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimit limits requests to route per API key, per user for access
+// tokens and per client IP otherwise. It must run after the route's
+// authentication middleware to see the caller.
+func RateLimit(limiter ratelimit.Limiter, route string) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		key := "ip:" + c.IP()
+		if principal, ok := c.Locals("principal").(domain.Principal); ok {
+			if principal.ApiKeyID != 0 {
+				key = fmt.Sprintf("key:%d", principal.ApiKeyID)
+			} else if principal.UserID != 0 {
+				key = fmt.Sprintf("user:%d", principal.UserID)
+			}
+		}
+
+		result, ok := limiter.Take(c.Context(), route, key)
+		if !ok {
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit.Requests, int(result.Limit.Period.Seconds())))
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit.Requests))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset.Seconds())))
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds(result.RetryAfter.Seconds())))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": helpers.ErrTooManyRequests.Error(),
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// seconds rounds up, so clients waiting the advertised time are not early.
+func seconds(s float64) int {
+	return int(math.Ceil(s))
+}
@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"kazokku/internal/app/delivery/handler"
+	"kazokku/internal/app/delivery/middleware"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/app/service"
+	"kazokku/internal/domain"
+	"kazokku/internal/infrastructure/ratelimit"
+	"kazokku/internal/infrastructure/totp"
+	"kazokku/internal/utils"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func NewAdminRoutes(conf utils.Config, apiKeyAuth middleware.ApiKeyAuth, otp totp.Manager, limiter ratelimit.Limiter, db *pgxpool.Pool, app *fiber.App, logger *slog.Logger) {
+	auditRepo := repository.NewAuditRepository(db)
+	apiKeyService := service.NewApiKeyService(db, logger, apiKeyAuth.HMACSecret, apiKeyAuth.Keys, auditRepo)
+	apiKeyHandler := handler.NewApiKeyHandler(apiKeyService)
+	userRepo := repository.NewUserRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	attemptRepo := repository.NewLoginAttemptRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	lockoutService := service.NewLockoutService(db, logger, conf.Account, attemptRepo, userRepo, auditRepo)
+	twoFactorService := service.NewTwoFactorService(db, logger, conf.TOTP, otp, userRepo, twoFactorRepo, sessionRepo, auditRepo)
+	adminUserHandler := handler.NewAdminUserHandler(lockoutService, twoFactorService)
+	keys := app.Group("/admin/api-keys")
+	users := app.Group("/admin/users")
+
+	keys.Use(middleware.ApiKey(apiKeyAuth, domain.ScopeKeysManage), middleware.RateLimit(limiter, "admin"))
+	{
+		keys.Post("", apiKeyHandler.Create)
+		keys.Get("", apiKeyHandler.GetAll)
+		keys.Post("/:key_id/rotate", apiKeyHandler.Rotate)
+		keys.Put("/:key_id/scopes", apiKeyHandler.UpdateScopes)
+		keys.Put("/:key_id/role", apiKeyHandler.UpdateRole)
+		keys.Delete("/:key_id", apiKeyHandler.Revoke)
+	}
+
+	users.Use(middleware.ApiKey(apiKeyAuth, domain.ScopeUsersAdmin), middleware.RateLimit(limiter, "admin"))
+	{
+		users.Post("/:user_id/unlock", adminUserHandler.Unlock)
+		users.Delete("/:user_id/2fa", adminUserHandler.ResetTwoFactor)
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"kazokku/internal/app/delivery/handler"
+	"kazokku/internal/app/delivery/middleware"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/app/service"
+	"kazokku/internal/domain"
+	"kazokku/internal/infrastructure/ratelimit"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func NewAuditRoutes(apiKeyAuth middleware.ApiKeyAuth, limiter ratelimit.Limiter, db *pgxpool.Pool, app *fiber.App, logger *slog.Logger) {
+	auditService := service.NewAuditService(logger, repository.NewAuditRepository(db))
+	auditHandler := handler.NewAuditHandler(auditService)
+
+	app.Get("/audit", middleware.ApiKey(apiKeyAuth, domain.ScopeAuditRead), middleware.RateLimit(limiter, "audit"), auditHandler.GetAll)
+}
@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"kazokku/internal/app/delivery/handler"
+	"kazokku/internal/app/delivery/middleware"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/app/service"
+	"kazokku/internal/infrastructure/mail"
+	"kazokku/internal/infrastructure/password"
+	"kazokku/internal/infrastructure/ratelimit"
+	"kazokku/internal/infrastructure/token"
+	"kazokku/internal/infrastructure/totp"
+	"kazokku/internal/utils"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func NewAuthRoutes(conf utils.Config, tokens token.Manager, mailer mail.Mailer, hasher password.Hasher, policy password.Policy, otp totp.Manager, limiter ratelimit.Limiter, db *pgxpool.Pool, app *fiber.App, logger *slog.Logger) {
+	userRepo := repository.NewUserRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	resetRepo := repository.NewPasswordResetRepository(db)
+	historyRepo := repository.NewHistoryRepository(db)
+	ccRepo := repository.NewCreditCardRepository(db)
+	mfaRepo := repository.NewMFAChallengeRepository(db)
+	attemptRepo := repository.NewLoginAttemptRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	lockoutService := service.NewLockoutService(db, logger, conf.Account, attemptRepo, userRepo, auditRepo)
+	twoFactorService := service.NewTwoFactorService(db, logger, conf.TOTP, otp, userRepo, twoFactorRepo, sessionRepo, auditRepo)
+	authService := service.NewAuthService(db, logger, conf, tokens, mailer, hasher, policy, userRepo, sessionRepo, resetRepo, historyRepo, ccRepo, mfaRepo, auditRepo, lockoutService, twoFactorService)
+	authHandler := handler.NewAuthHandler(authService)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService)
+	auth := app.Group("/auth")
+	me := app.Group("/me")
+
+	userToken := middleware.UserToken(tokens, sessionRepo)
+	limit := func(route string) fiber.Handler {
+		return middleware.RateLimit(limiter, route)
+	}
+	{
+		auth.Post("/login", limit("login"), authHandler.Login)
+		auth.Post("/refresh", limit("refresh"), authHandler.Refresh)
+		auth.Post("/logout", userToken, limit("logout"), authHandler.Logout)
+		auth.Post("/password/forgot", limit("password_forgot"), authHandler.ForgotPassword)
+		auth.Post("/password/reset", limit("password_reset"), authHandler.ResetPassword)
+		auth.Post("/2fa/verify", limit("mfa_verify"), authHandler.VerifyMFA)
+		auth.Post("/2fa/enrol", limit("mfa_enrol"), authHandler.EnrolMFA)
+		auth.Post("/2fa/confirm", limit("mfa_confirm"), authHandler.ConfirmMFA)
+	}
+
+	me.Use(userToken, limit("sessions"))
+	{
+		me.Get("/sessions", authHandler.GetSessions)
+		me.Delete("/sessions/:session_id", authHandler.RevokeSession)
+		me.Post("/2fa/enrol", twoFactorHandler.Enrol)
+		me.Post("/2fa/confirm", twoFactorHandler.Confirm)
+	}
+}
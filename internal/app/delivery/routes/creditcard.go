@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"kazokku/internal/app/delivery/handler"
+	"kazokku/internal/app/delivery/middleware"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/app/service"
+	"kazokku/internal/domain"
+	"kazokku/internal/infrastructure/cardbrand"
+	"kazokku/internal/infrastructure/envelope"
+	"kazokku/internal/infrastructure/ratelimit"
+	"kazokku/internal/infrastructure/token"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func NewCreditCardRoutes(tokens token.Manager, keys envelope.Keyring, brands cardbrand.Table, apiKeyAuth middleware.ApiKeyAuth, limiter ratelimit.Limiter, db *pgxpool.Pool, app *fiber.App, logger *slog.Logger) {
+	sessionRepo := repository.NewSessionRepository(db)
+	vault := service.NewCardVault(keys, brands, repository.NewVaultRepository(db))
+	ccService := service.NewCreditCardService(db, logger, vault, brands, repository.NewUserRepository(db), repository.NewCreditCardRepository(db), repository.NewAuditRepository(db))
+	ccHandler := handler.NewCreditCardHandler(ccService)
+	cards := app.Group("/user/:user_id/cards")
+
+	apiKeyOrSelf := func(scopes ...string) fiber.Handler {
+		return middleware.ApiKeyOrSelf(tokens, sessionRepo, apiKeyAuth, scopes...)
+	}
+	limit := func(route string) fiber.Handler {
+		return middleware.RateLimit(limiter, route)
+	}
+	{
+		cards.Get("", apiKeyOrSelf(domain.ScopeCardsReadMasked), limit("card_list"), ccHandler.GetAll)
+		cards.Post("", apiKeyOrSelf(domain.ScopeCardsWrite), limit("card_create"), ccHandler.Create)
+		cards.Patch("/:card_id", apiKeyOrSelf(domain.ScopeCardsWrite), limit("card_update"), ccHandler.UpdateByID)
+		cards.Delete("/:card_id", apiKeyOrSelf(domain.ScopeCardsWrite), limit("card_delete"), ccHandler.DeleteByID)
+	}
+}
@@ -5,25 +5,51 @@ import (
 	"kazokku/internal/app/delivery/middleware"
 	"kazokku/internal/app/repository"
 	"kazokku/internal/app/service"
+	"kazokku/internal/domain"
+	"kazokku/internal/infrastructure/cardbrand"
+	"kazokku/internal/infrastructure/envelope"
+	"kazokku/internal/infrastructure/mail"
+	"kazokku/internal/infrastructure/password"
+	"kazokku/internal/infrastructure/ratelimit"
+	"kazokku/internal/infrastructure/token"
+	"kazokku/internal/utils"
 	"log/slog"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func NewUserRoutes(db *pgxpool.Pool, app *fiber.App, logger *slog.Logger) {
+func NewUserRoutes(conf utils.Config, tokens token.Manager, mailer mail.Mailer, hasher password.Hasher, policy password.Policy, keys envelope.Keyring, brands cardbrand.Table, apiKeyAuth middleware.ApiKeyAuth, limiter ratelimit.Limiter, db *pgxpool.Pool, app *fiber.App, logger *slog.Logger) {
 	userRepo := repository.NewUserRepository(db)
 	ccRepo := repository.NewCreditCardRepository(db)
 	photoRepo := repository.NewPhotoRepository(db)
-	userService := service.NewUserService(db, logger, userRepo, ccRepo, photoRepo)
-	userHandler := handler.NewUserHandler(userService)
+	historyRepo := repository.NewHistoryRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	verifyRepo := repository.NewEmailVerificationRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	vault := service.NewCardVault(keys, brands, repository.NewVaultRepository(db))
+	userService := service.NewUserService(db, logger, conf, mailer, hasher, policy, vault, brands, userRepo, ccRepo, photoRepo, historyRepo, sessionRepo, verifyRepo, auditRepo)
+	userHandler := handler.NewUserHandler(userService, conf.App.RequireIfMatch)
 	user := app.Group("/user")
 
-	user.Use(middleware.ApiKey())
+	apiKey := func(scopes ...string) fiber.Handler {
+		return middleware.ApiKey(apiKeyAuth, scopes...)
+	}
+	apiKeyOrSelf := func(scopes ...string) fiber.Handler {
+		return middleware.ApiKeyOrSelf(tokens, sessionRepo, apiKeyAuth, scopes...)
+	}
+	limit := func(route string) fiber.Handler {
+		return middleware.RateLimit(limiter, route)
+	}
 	{
-		user.Post("/register", userHandler.Register)
-		user.Get("/list", userHandler.GetAll)
-		user.Get("/:user_id", userHandler.GetByID)
-		user.Patch("", userHandler.UpdateByID)
+		user.Post("/register", apiKey(domain.ScopeUsersRegister), limit("register"), userHandler.Register)
+		user.Get("/list", apiKey(domain.ScopeUsersRead), limit("user_list"), userHandler.GetAll)
+		user.Post("/email/confirm", limit("email_confirm"), userHandler.ConfirmEmail)
+		user.Get("/:user_id", apiKeyOrSelf(domain.ScopeUsersRead), limit("user_get"), userHandler.GetByID)
+		user.Patch("", apiKey(domain.ScopeUsersWrite), limit("user_update"), userHandler.UpdateByID)
+		user.Patch("/:user_id", apiKeyOrSelf(domain.ScopeUsersWrite), limit("user_update"), userHandler.UpdateByID)
+		user.Delete("/:user_id", apiKey(domain.ScopeUsersDelete), limit("user_delete"), userHandler.DeleteByID)
+		user.Post("/:user_id/restore", apiKey(domain.ScopeUsersDelete), limit("user_restore"), userHandler.RestoreByID)
+		user.Get("/:user_id/history", apiKey(domain.ScopeUsersRead), limit("user_history"), userHandler.GetHistory)
 	}
 }
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ApiKeyRepository interface {
+	Insert(context.Context, pgx.Tx, domain.ApiKey) (uint, error)
+	GetAll(context.Context) ([]domain.ApiKey, error)
+	GetByID(context.Context, uint) (domain.ApiKey, error)
+	GetByHash(context.Context, string) (domain.ApiKey, error)
+	Rotate(context.Context, pgx.Tx, uint, string, string) error
+	UpdateScopes(context.Context, pgx.Tx, uint, []string) error
+	UpdateRole(context.Context, pgx.Tx, uint, string, []string) error
+	Revoke(context.Context, pgx.Tx, uint) error
+	Touch(context.Context, uint) error
+	Invalidate()
+}
+
+type apiKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewApiKeyRepository(db *pgxpool.Pool) apiKeyRepository {
+	return apiKeyRepository{db}
+}
+
+func (repo apiKeyRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.ApiKey) (uint, error) {
+	stmt := "INSERT INTO api_keys(name, owner, key_hash, scopes, role, auth_mode, hmac_salt, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;"
+	var id uint
+	err := tx.QueryRow(ctx, stmt, data.Name, data.Owner, data.KeyHash, data.Scopes, data.Role, data.AuthMode, data.HMACSalt, data.ExpiresAt).Scan(&id)
+	if err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+func (repo apiKeyRepository) GetAll(ctx context.Context) ([]domain.ApiKey, error) {
+	stmt := "SELECT id, name, owner, scopes, COALESCE(role, ''), auth_mode, created_at, rotated_at, expires_at, last_used_at, revoked_at FROM api_keys ORDER BY id;"
+	var keys []domain.ApiKey
+	rows, err := repo.db.Query(ctx, stmt)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key domain.ApiKey
+		err = rows.Scan(&key.ID, &key.Name, &key.Owner, &key.Scopes, &key.Role, &key.AuthMode, &key.CreatedAt, &key.RotatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (repo apiKeyRepository) GetByID(ctx context.Context, keyID uint) (domain.ApiKey, error) {
+	stmt := "SELECT id, name, owner, key_hash, scopes, COALESCE(role, ''), auth_mode, hmac_salt, created_at, rotated_at, expires_at, last_used_at, revoked_at FROM api_keys WHERE id = $1;"
+	var key domain.ApiKey
+	err := repo.db.QueryRow(ctx, stmt, keyID).Scan(&key.ID, &key.Name, &key.Owner, &key.KeyHash, &key.Scopes, &key.Role, &key.AuthMode, &key.HMACSalt, &key.CreatedAt, &key.RotatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return key, helpers.ErrApiKeyNotFound
+		}
+		return key, err
+	}
+
+	return key, nil
+}
+
+func (repo apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (domain.ApiKey, error) {
+	stmt := "SELECT id, name, owner, key_hash, scopes, COALESCE(role, ''), auth_mode, hmac_salt, created_at, rotated_at, expires_at, last_used_at, revoked_at FROM api_keys WHERE key_hash = $1;"
+	var key domain.ApiKey
+	err := repo.db.QueryRow(ctx, stmt, keyHash).Scan(&key.ID, &key.Name, &key.Owner, &key.KeyHash, &key.Scopes, &key.Role, &key.AuthMode, &key.HMACSalt, &key.CreatedAt, &key.RotatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return key, helpers.ErrApiKeyNotFound
+		}
+		return key, err
+	}
+
+	return key, nil
+}
+
+// Rotate replaces the hash and signing salt of an unrevoked key,
+// invalidating the previous plaintext and signing secret immediately.
+func (repo apiKeyRepository) Rotate(ctx context.Context, tx pgx.Tx, keyID uint, keyHash, hmacSalt string) error {
+	stmt := "UPDATE api_keys SET key_hash = $1, hmac_salt = $2, rotated_at = NOW() WHERE id = $3 AND revoked_at IS NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, keyHash, hmacSalt, keyID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+func (repo apiKeyRepository) UpdateScopes(ctx context.Context, tx pgx.Tx, keyID uint, scopes []string) error {
+	stmt := "UPDATE api_keys SET scopes = $1 WHERE id = $2 AND revoked_at IS NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, scopes, keyID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+func (repo apiKeyRepository) UpdateRole(ctx context.Context, tx pgx.Tx, keyID uint, role string, scopes []string) error {
+	stmt := "UPDATE api_keys SET role = $1, scopes = $2 WHERE id = $3 AND revoked_at IS NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, role, scopes, keyID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+func (repo apiKeyRepository) Revoke(ctx context.Context, tx pgx.Tx, keyID uint) error {
+	stmt := "UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, keyID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+func (repo apiKeyRepository) Touch(ctx context.Context, keyID uint) error {
+	stmt := "UPDATE api_keys SET last_used_at = NOW() WHERE id = $1;"
+
+	_, err := repo.db.Exec(ctx, stmt, keyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Invalidate does nothing, there is no cache to drop.
+func (repo apiKeyRepository) Invalidate() {}
+
+// maxCachedApiKeys bounds the lookup cache, which also remembers unknown
+// keys and could otherwise be grown by a client sending random ones.
+const maxCachedApiKeys = 1024
+
+type cachedApiKey struct {
+	key       domain.ApiKey
+	err       error
+	expiresAt time.Time
+}
+
+// cachedApiKeyRepository keeps GetByID and GetByHash results for ttl so authenticating a
+// request does not cost a query, and writes last_used_at at most once per
+// ttl for each key. Callers drop the cache with Invalidate once a change to
+// a key has committed; changes made by other instances become visible once
+// the ttl has passed.
+type cachedApiKeyRepository struct {
+	ApiKeyRepository
+	ttl     time.Duration
+	mu      sync.Mutex
+	keys    map[string]cachedApiKey
+	byID    map[uint]cachedApiKey
+	touched map[uint]time.Time
+}
+
+func NewCachedApiKeyRepository(repo ApiKeyRepository, ttl time.Duration) *cachedApiKeyRepository {
+	return &cachedApiKeyRepository{
+		ApiKeyRepository: repo,
+		ttl:              ttl,
+		keys:             make(map[string]cachedApiKey),
+		byID:             make(map[uint]cachedApiKey),
+		touched:          make(map[uint]time.Time),
+	}
+}
+
+func (repo *cachedApiKeyRepository) GetByID(ctx context.Context, keyID uint) (domain.ApiKey, error) {
+	repo.mu.Lock()
+	cached, ok := repo.byID[keyID]
+	repo.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.key, cached.err
+	}
+
+	key, err := repo.ApiKeyRepository.GetByID(ctx, keyID)
+	if err != nil && !errors.Is(err, helpers.ErrApiKeyNotFound) {
+		return key, err
+	}
+
+	repo.mu.Lock()
+	if len(repo.byID) >= maxCachedApiKeys {
+		clear(repo.byID)
+	}
+	repo.byID[keyID] = cachedApiKey{key: key, err: err, expiresAt: time.Now().Add(repo.ttl)}
+	repo.mu.Unlock()
+
+	return key, err
+}
+
+func (repo *cachedApiKeyRepository) GetByHash(ctx context.Context, keyHash string) (domain.ApiKey, error) {
+	repo.mu.Lock()
+	cached, ok := repo.keys[keyHash]
+	repo.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.key, cached.err
+	}
+
+	key, err := repo.ApiKeyRepository.GetByHash(ctx, keyHash)
+	if err != nil && !errors.Is(err, helpers.ErrApiKeyNotFound) {
+		return key, err
+	}
+
+	repo.mu.Lock()
+	if len(repo.keys) >= maxCachedApiKeys {
+		clear(repo.keys)
+	}
+	repo.keys[keyHash] = cachedApiKey{key: key, err: err, expiresAt: time.Now().Add(repo.ttl)}
+	repo.mu.Unlock()
+
+	return key, err
+}
+
+func (repo *cachedApiKeyRepository) Touch(ctx context.Context, keyID uint) error {
+	repo.mu.Lock()
+	if last, ok := repo.touched[keyID]; ok && time.Since(last) < repo.ttl {
+		repo.mu.Unlock()
+		return nil
+	}
+	repo.touched[keyID] = time.Now()
+	repo.mu.Unlock()
+
+	return repo.ApiKeyRepository.Touch(ctx, keyID)
+}
+
+// Invalidate drops the cached lookups. Called before the change commits, a
+// concurrent lookup could cache the old row again.
+func (repo *cachedApiKeyRepository) Invalidate() {
+	repo.mu.Lock()
+	clear(repo.keys)
+	clear(repo.byID)
+	repo.mu.Unlock()
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/domain"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditRepository interface {
+	Insert(context.Context, pgx.Tx, domain.AuditEvent) error
+	GetAll(context.Context, dto.AuditQuery) ([]domain.AuditEvent, error)
+	GetAfter(context.Context, uint, time.Time, int) ([]domain.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditRepository(db *pgxpool.Pool) auditRepository {
+	return auditRepository{db}
+}
+
+func (repo auditRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.AuditEvent) error {
+	stmt := `INSERT INTO audit_events(actor_type, actor_id, request_id, ip, action, target_type, target_id, changes)
+	VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8);`
+
+	changes := data.Changes
+	if changes == nil {
+		changes = []domain.FieldChange{}
+	}
+
+	_, err := tx.Exec(ctx, stmt, data.ActorType, data.ActorID, data.RequestID, data.IP, data.Action, data.TargetType, data.TargetID, changes)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo auditRepository) GetAll(ctx context.Context, query dto.AuditQuery) ([]domain.AuditEvent, error) {
+	var args []any
+	var filters []string
+	filter := func(cond string, arg any) {
+		args = append(args, arg)
+		filters = append(filters, fmt.Sprintf(cond, len(args)))
+	}
+
+	if query.ActorType != "" {
+		filter("actor_type = $%d", query.ActorType)
+	}
+	if query.ActorID != 0 {
+		filter("actor_id = $%d", query.ActorID)
+	}
+	if query.Action != "" {
+		filter("action = $%d", query.Action)
+	}
+	if query.TargetType != "" {
+		filter("target_type = $%d", query.TargetType)
+	}
+	if query.TargetID != 0 {
+		filter("target_id = $%d", query.TargetID)
+	}
+	if query.RequestID != "" {
+		filter("request_id = $%d", query.RequestID)
+	}
+	if query.From != "" {
+		filter("created_at >= $%d", query.From)
+	}
+	if query.To != "" {
+		filter("created_at <= $%d", query.To)
+	}
+
+	var where string
+	if len(filters) > 0 {
+		where = "WHERE " + strings.Join(filters, " AND ")
+	}
+
+	stmt := fmt.Sprintf(`SELECT id, actor_type, COALESCE(actor_id, 0), request_id, ip, action, target_type, target_id, changes, created_at
+	FROM audit_events
+	%s
+	ORDER BY id DESC
+	OFFSET %d
+	LIMIT %d;`, where, query.Offset, query.Limit)
+
+	return repo.query(ctx, stmt, args...)
+}
+
+// GetAfter returns up to limit events with an id above afterID that were
+// created before before, oldest first.
+func (repo auditRepository) GetAfter(ctx context.Context, afterID uint, before time.Time, limit int) ([]domain.AuditEvent, error) {
+	stmt := `SELECT id, actor_type, COALESCE(actor_id, 0), request_id, ip, action, target_type, target_id, changes, created_at
+	FROM audit_events
+	WHERE id > $1 AND created_at < $2
+	ORDER BY id
+	LIMIT $3;`
+
+	return repo.query(ctx, stmt, afterID, before, limit)
+}
+
+func (repo auditRepository) query(ctx context.Context, stmt string, args ...any) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+	rows, err := repo.db.Query(ctx, stmt, args...)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event domain.AuditEvent
+		err = rows.Scan(&event.ID, &event.ActorType, &event.ActorID, &event.RequestID, &event.IP, &event.Action, &event.TargetType, &event.TargetID, &event.Changes, &event.CreatedAt)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -2,15 +2,29 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type CreditCardRepository interface {
-	Insert(context.Context, pgx.Tx, domain.CreditCard) error
+	Insert(context.Context, pgx.Tx, domain.CreditCard) (uint, error)
 	Update(context.Context, pgx.Tx, domain.CreditCard) error
+	GetByUserID(context.Context, uint) ([]domain.CreditCard, error)
+	GetByUserIDs(context.Context, []uint) (map[uint][]domain.CreditCard, error)
+	GetForUpdate(context.Context, pgx.Tx, uint, uint) (domain.CreditCard, error)
+	Delete(context.Context, pgx.Tx, uint) error
+	SetDefault(context.Context, pgx.Tx, uint, uint) error
+	PromoteDefault(context.Context, pgx.Tx, uint) error
+	GetUntokenizedForUpdate(context.Context, pgx.Tx, int) ([]domain.CreditCard, error)
+	SetToken(context.Context, pgx.Tx, uint, domain.CreditCard) error
+	ExistsByUserID(context.Context, uint) (bool, error)
+	DeleteByUserID(context.Context, pgx.Tx, uint) error
+	RestoreByUserID(context.Context, pgx.Tx, uint) error
+	PurgeByUserID(context.Context, pgx.Tx, uint) ([]string, error)
 }
 
 type creditCardRepository struct {
@@ -21,10 +35,33 @@ func NewCreditCardRepository(db *pgxpool.Pool) creditCardRepository {
 	return creditCardRepository{db}
 }
 
-func (repo creditCardRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.CreditCard) error {
-	stmt := "INSERT INTO credit_cards(user_id, type, number, name, expired, cvv) VALUES ($1, $2, $3, $4, $5, $6);"
+// Insert stores a card whose number has been handed to the vault. A user
+// can only have one default card, see SetDefault.
+func (repo creditCardRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.CreditCard) (uint, error) {
+	stmt := "INSERT INTO credit_cards(user_id, type, name, expired, token, last4, is_default) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;"
+	var id uint
+	err := tx.QueryRow(ctx, stmt, data.UserID, data.Type, data.Name, data.Expired, data.Token, data.Last4, data.IsDefault).Scan(&id)
+	if err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+// Update changes the provided fields of card data.ID. A new token replaces
+// whatever was left of the card from before the vault.
+func (repo creditCardRepository) Update(ctx context.Context, tx pgx.Tx, data domain.CreditCard) error {
+	stmt := `UPDATE credit_cards SET type = COALESCE($1, type), name = COALESCE($2, name), expired = COALESCE($3, expired),
+	token = COALESCE($4, token), last4 = COALESCE($5, last4),
+	number = CASE WHEN $4::VARCHAR IS NULL THEN number END,
+	key_id = CASE WHEN $4::VARCHAR IS NULL THEN key_id END,
+	data_key = CASE WHEN $4::VARCHAR IS NULL THEN data_key END,
+	nonce = CASE WHEN $4::VARCHAR IS NULL THEN nonce END,
+	ciphertext = CASE WHEN $4::VARCHAR IS NULL THEN ciphertext END,
+	updated_at = NOW()
+	WHERE id = $6 AND deleted_at IS NULL;`
 
-	_, err := tx.Exec(ctx, stmt, data.UserID, data.Type, data.Number, data.Name, data.Expired, data.CVV)
+	_, err := tx.Exec(ctx, stmt, data.Type, data.Name, data.Expired, data.Token, data.Last4, data.ID)
 	if err != nil {
 		return err
 	}
@@ -32,13 +69,202 @@ func (repo creditCardRepository) Insert(ctx context.Context, tx pgx.Tx, data dom
 	return nil
 }
 
-func (repo creditCardRepository) Update(ctx context.Context, tx pgx.Tx, data domain.CreditCard) error {
-	stmt := "UPDATE credit_cards SET type = COALESCE($1, type), number = COALESCE($2, number), name = COALESCE($3, name), expired = COALESCE($4, expired), cvv = COALESCE($5, cvv) WHERE user_id = $6;"
+// GetByUserID returns the cards of the user, the default one first.
+func (repo creditCardRepository) GetByUserID(ctx context.Context, userID uint) ([]domain.CreditCard, error) {
+	cards, err := repo.GetByUserIDs(ctx, []uint{userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return cards[userID], nil
+}
+
+// GetByUserIDs returns the cards of the users, keyed by user and with each
+// default card first.
+func (repo creditCardRepository) GetByUserIDs(ctx context.Context, userIDs []uint) (map[uint][]domain.CreditCard, error) {
+	stmt := `SELECT id, user_id, type, last4, name, expired, is_default, created_at, updated_at
+	FROM credit_cards
+	WHERE user_id = ANY($1) AND deleted_at IS NULL
+	ORDER BY is_default DESC, id;`
+	cards := make(map[uint][]domain.CreditCard)
+	rows, err := repo.db.Query(ctx, stmt, userIDs)
+	if err != nil {
+		return cards, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cc domain.CreditCard
+		err = rows.Scan(&cc.ID, &cc.UserID, &cc.Type, &cc.Last4, &cc.Name, &cc.Expired, &cc.IsDefault, &cc.CreatedAt, &cc.UpdatedAt)
+		if err != nil {
+			return cards, err
+		}
+		cards[cc.UserID] = append(cards[cc.UserID], cc)
+	}
+
+	return cards, rows.Err()
+}
+
+// GetForUpdate locks card cardID of the user.
+func (repo creditCardRepository) GetForUpdate(ctx context.Context, tx pgx.Tx, userID, cardID uint) (domain.CreditCard, error) {
+	stmt := `SELECT id, user_id, type, name, expired, token, last4, is_default
+	FROM credit_cards
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	FOR UPDATE;`
+	var cc domain.CreditCard
+	err := tx.QueryRow(ctx, stmt, cardID, userID).Scan(&cc.ID, &cc.UserID, &cc.Type, &cc.Name, &cc.Expired, &cc.Token, &cc.Last4, &cc.IsDefault)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return cc, helpers.ErrCardNotFound
+		}
+		return cc, err
+	}
+
+	return cc, nil
+}
+
+func (repo creditCardRepository) Delete(ctx context.Context, tx pgx.Tx, cardID uint) error {
+	stmt := "DELETE FROM credit_cards WHERE id = $1;"
+
+	_, err := tx.Exec(ctx, stmt, cardID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetDefault makes card cardID the default of the user, clearing the flag
+// on the previous one first so that only one is ever set.
+func (repo creditCardRepository) SetDefault(ctx context.Context, tx pgx.Tx, userID, cardID uint) error {
+	stmt := "UPDATE credit_cards SET is_default = FALSE, updated_at = NOW() WHERE user_id = $1 AND is_default AND id <> $2;"
+
+	_, err := tx.Exec(ctx, stmt, userID, cardID)
+	if err != nil {
+		return err
+	}
+
+	stmt = "UPDATE credit_cards SET is_default = TRUE, updated_at = NOW() WHERE id = $1 AND user_id = $2 AND NOT is_default;"
+
+	_, err = tx.Exec(ctx, stmt, cardID, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
 
-	_, err := tx.Exec(ctx, stmt, data.Type, data.Number, data.Name, data.Expired, data.CVV, data.UserID)
+// PromoteDefault makes the oldest card of the user the default when they
+// have none, after their default card was deleted.
+func (repo creditCardRepository) PromoteDefault(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := `UPDATE credit_cards SET is_default = TRUE, updated_at = NOW()
+	WHERE id = (SELECT id FROM credit_cards WHERE user_id = $1 AND deleted_at IS NULL ORDER BY id LIMIT 1)
+	AND NOT EXISTS (SELECT 1 FROM credit_cards WHERE user_id = $1 AND is_default);`
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetUntokenizedForUpdate locks up to limit cards stored before the vault,
+// either in plaintext or sealed. Cards locked by another transaction are
+// skipped.
+func (repo creditCardRepository) GetUntokenizedForUpdate(ctx context.Context, tx pgx.Tx, limit int) ([]domain.CreditCard, error) {
+	stmt := `SELECT id, COALESCE(user_id, 0), number, expired, COALESCE(key_id, ''), data_key, nonce, ciphertext
+	FROM credit_cards
+	WHERE token IS NULL
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED;`
+	var cards []domain.CreditCard
+	rows, err := tx.Query(ctx, stmt, limit)
+	if err != nil {
+		return cards, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cc domain.CreditCard
+		err = rows.Scan(&cc.ID, &cc.UserID, &cc.Number, &cc.Expired, &cc.Sealed.KeyID, &cc.Sealed.DataKey, &cc.Sealed.Nonce, &cc.Sealed.Ciphertext)
+		if err != nil {
+			return cards, err
+		}
+		cards = append(cards, cc)
+	}
+
+	return cards, rows.Err()
+}
+
+// SetToken stores the vault token, last four digits and expiry of card
+// cardID and clears the number it was stored with before.
+func (repo creditCardRepository) SetToken(ctx context.Context, tx pgx.Tx, cardID uint, data domain.CreditCard) error {
+	stmt := `UPDATE credit_cards SET token = $1, last4 = $2, expired = $3,
+	number = NULL, key_id = NULL, data_key = NULL, nonce = NULL, ciphertext = NULL
+	WHERE id = $4;`
+
+	_, err := tx.Exec(ctx, stmt, data.Token, data.Last4, data.Expired, cardID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo creditCardRepository) ExistsByUserID(ctx context.Context, userID uint) (bool, error) {
+	stmt := "SELECT EXISTS(SELECT 1 FROM credit_cards WHERE user_id = $1 AND deleted_at IS NULL);"
+	var exists bool
+	err := repo.db.QueryRow(ctx, stmt, userID).Scan(&exists)
+	if err != nil {
+		return exists, err
+	}
+
+	return exists, nil
+}
+
+func (repo creditCardRepository) DeleteByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE credit_cards SET deleted_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND deleted_at IS NULL;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo creditCardRepository) RestoreByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE credit_cards SET deleted_at = NULL, updated_at = NOW() WHERE user_id = $1 AND deleted_at IS NOT NULL;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// PurgeByUserID deletes the user's cards and returns their vault tokens.
+func (repo creditCardRepository) PurgeByUserID(ctx context.Context, tx pgx.Tx, userID uint) ([]string, error) {
+	stmt := "DELETE FROM credit_cards WHERE user_id = $1 RETURNING token;"
+	var tokens []string
+	rows, err := tx.Query(ctx, stmt, userID)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token *string
+		if err = rows.Scan(&token); err != nil {
+			return tokens, err
+		}
+		if token != nil {
+			tokens = append(tokens, *token)
+		}
+	}
+
+	return tokens, rows.Err()
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type EmailVerificationRepository interface {
+	Insert(context.Context, pgx.Tx, domain.EmailVerification) error
+	GetForUpdate(context.Context, pgx.Tx, string) (domain.EmailVerification, error)
+	InvalidateByUserID(context.Context, pgx.Tx, uint) error
+}
+
+type emailVerificationRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewEmailVerificationRepository(db *pgxpool.Pool) emailVerificationRepository {
+	return emailVerificationRepository{db}
+}
+
+func (repo emailVerificationRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.EmailVerification) error {
+	stmt := "INSERT INTO email_verifications(user_id, email, token_hash, expires_at) VALUES ($1, $2, $3, $4);"
+
+	_, err := tx.Exec(ctx, stmt, data.UserID, data.Email, data.TokenHash, data.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo emailVerificationRepository) GetForUpdate(ctx context.Context, tx pgx.Tx, tokenHash string) (domain.EmailVerification, error) {
+	stmt := "SELECT id, user_id, email, token_hash, expires_at, used_at FROM email_verifications WHERE token_hash = $1 FOR UPDATE;"
+	var verification domain.EmailVerification
+	err := tx.QueryRow(ctx, stmt, tokenHash).Scan(&verification.ID, &verification.UserID, &verification.Email, &verification.TokenHash, &verification.ExpiresAt, &verification.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return verification, helpers.ErrInvalidVerificationToken
+		}
+		return verification, err
+	}
+
+	return verification, nil
+}
+
+// InvalidateByUserID marks every outstanding verification token of the user
+// as used, so only the most recently requested address can be confirmed.
+func (repo emailVerificationRepository) InvalidateByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE email_verifications SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type HistoryRepository interface {
+	Insert(context.Context, pgx.Tx, domain.UserHistory) error
+	GetByUserID(context.Context, uint, dto.HistoryQuery) ([]domain.UserHistory, error)
+}
+
+type historyRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewHistoryRepository(db *pgxpool.Pool) historyRepository {
+	return historyRepository{db}
+}
+
+func (repo historyRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.UserHistory) error {
+	stmt := "INSERT INTO user_history(user_id, version, changes, actor_type, actor_id) VALUES ($1, $2, $3, $4, NULLIF($5, 0));"
+
+	_, err := tx.Exec(ctx, stmt, data.UserID, data.Version, data.Changes, data.ActorType, data.ActorID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo historyRepository) GetByUserID(ctx context.Context, userID uint, query dto.HistoryQuery) ([]domain.UserHistory, error) {
+	stmt := `SELECT user_id, version, changes, COALESCE(actor_type, ''), COALESCE(actor_id, 0), created_at
+	FROM user_history
+	WHERE user_id = $1
+	ORDER BY version DESC
+	OFFSET $2
+	LIMIT $3;`
+	var history []domain.UserHistory
+	rows, err := repo.db.Query(ctx, stmt, userID, query.Offset, query.Limit)
+	if err != nil {
+		return history, err
+	}
+
+	for rows.Next() {
+		var entry domain.UserHistory
+		err = rows.Scan(&entry.UserID, &entry.Version, &entry.Changes, &entry.ActorType, &entry.ActorID, &entry.CreatedAt)
+		if err != nil {
+			return history, err
+		}
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
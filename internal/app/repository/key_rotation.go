@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"kazokku/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type KeyRotationRepository interface {
+	Start(context.Context, string) (domain.KeyRotation, error)
+	Advance(context.Context, pgx.Tx, string, uint, int) error
+	Restart(context.Context, string) error
+	Complete(context.Context, string) error
+}
+
+type keyRotationRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewKeyRotationRepository(db *pgxpool.Pool) keyRotationRepository {
+	return keyRotationRepository{db}
+}
+
+// Start returns the rotation to keyID, creating it when there is none yet.
+// A rotation already under way is resumed where it stopped, one that was
+// completed before, when the vault was last rotated to keyID, starts over.
+func (repo keyRotationRepository) Start(ctx context.Context, keyID string) (domain.KeyRotation, error) {
+	stmt := `INSERT INTO key_rotations(key_id) VALUES ($1)
+			ON CONFLICT (key_id) DO UPDATE SET
+				last_entry_id = CASE WHEN key_rotations.completed_at IS NULL THEN key_rotations.last_entry_id ELSE 0 END,
+				rotated = CASE WHEN key_rotations.completed_at IS NULL THEN key_rotations.rotated ELSE 0 END,
+				started_at = CASE WHEN key_rotations.completed_at IS NULL THEN key_rotations.started_at ELSE NOW() END,
+				completed_at = NULL,
+				updated_at = NOW()
+			RETURNING key_id, last_entry_id, rotated, started_at, updated_at, completed_at;`
+	var rotation domain.KeyRotation
+	err := repo.db.QueryRow(ctx, stmt, keyID).Scan(&rotation.KeyID, &rotation.LastEntryID, &rotation.Rotated, &rotation.StartedAt, &rotation.UpdatedAt, &rotation.CompletedAt)
+	if err != nil {
+		return rotation, err
+	}
+
+	return rotation, nil
+}
+
+// Advance records that entries up to lastEntryID are done, count of them
+// rotated in this batch. It runs in the batch's tx so progress and entries
+// are committed together.
+func (repo keyRotationRepository) Advance(ctx context.Context, tx pgx.Tx, keyID string, lastEntryID uint, count int) error {
+	stmt := "UPDATE key_rotations SET last_entry_id = $1, rotated = rotated + $2, updated_at = NOW() WHERE key_id = $3;"
+
+	_, err := tx.Exec(ctx, stmt, lastEntryID, count, keyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Restart makes the next run walk the vault from the beginning again.
+func (repo keyRotationRepository) Restart(ctx context.Context, keyID string) error {
+	stmt := "UPDATE key_rotations SET last_entry_id = 0, completed_at = NULL, updated_at = NOW() WHERE key_id = $1;"
+
+	_, err := repo.db.Exec(ctx, stmt, keyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo keyRotationRepository) Complete(ctx context.Context, keyID string) error {
+	stmt := "UPDATE key_rotations SET completed_at = NOW(), updated_at = NOW() WHERE key_id = $1;"
+
+	_, err := repo.db.Exec(ctx, stmt, keyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LoginAttemptRepository interface {
+	Get(context.Context, string, string) (domain.LoginAttempt, error)
+	RecordFailure(context.Context, string, string, time.Duration) (uint, error)
+	Delay(context.Context, string, string, time.Time) error
+	Lock(context.Context, string, string, time.Time) error
+	Reset(context.Context, string, string) error
+	Unlock(context.Context, pgx.Tx, string, string) error
+}
+
+type loginAttemptRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginAttemptRepository(db *pgxpool.Pool) loginAttemptRepository {
+	return loginAttemptRepository{db}
+}
+
+// Get returns the attempts of subject, or an empty record when it has no
+// recent failures.
+func (repo loginAttemptRepository) Get(ctx context.Context, scope, subject string) (domain.LoginAttempt, error) {
+	stmt := "SELECT scope, subject, failures, last_failed_at, delayed_until, locked_until FROM login_attempts WHERE scope = $1 AND subject = $2;"
+	var attempt domain.LoginAttempt
+	err := repo.db.QueryRow(ctx, stmt, scope, subject).Scan(&attempt.Scope, &attempt.Subject, &attempt.Failures, &attempt.LastFailedAt, &attempt.DelayedUntil, &attempt.LockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.LoginAttempt{Scope: scope, Subject: subject}, nil
+		}
+		return attempt, err
+	}
+
+	return attempt, nil
+}
+
+// RecordFailure counts a failed login and returns the number of failures
+// within window, counting restarts when the previous one is older.
+func (repo loginAttemptRepository) RecordFailure(ctx context.Context, scope, subject string, window time.Duration) (uint, error) {
+	stmt := `INSERT INTO login_attempts(scope, subject, failures, last_failed_at) VALUES ($1, $2, 1, NOW())
+			ON CONFLICT (scope, subject) DO UPDATE SET
+				failures = CASE WHEN login_attempts.last_failed_at < NOW() - make_interval(secs => $3) THEN 1 ELSE login_attempts.failures + 1 END,
+				last_failed_at = NOW()
+			RETURNING failures;`
+	var failures uint
+	err := repo.db.QueryRow(ctx, stmt, scope, subject, window.Seconds()).Scan(&failures)
+	if err != nil {
+		return failures, err
+	}
+
+	return failures, nil
+}
+
+func (repo loginAttemptRepository) Delay(ctx context.Context, scope, subject string, until time.Time) error {
+	stmt := "UPDATE login_attempts SET delayed_until = $1 WHERE scope = $2 AND subject = $3;"
+
+	_, err := repo.db.Exec(ctx, stmt, until, scope, subject)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo loginAttemptRepository) Lock(ctx context.Context, scope, subject string, until time.Time) error {
+	stmt := "UPDATE login_attempts SET locked_until = $1 WHERE scope = $2 AND subject = $3;"
+
+	_, err := repo.db.Exec(ctx, stmt, until, scope, subject)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo loginAttemptRepository) Reset(ctx context.Context, scope, subject string) error {
+	stmt := "DELETE FROM login_attempts WHERE scope = $1 AND subject = $2;"
+
+	_, err := repo.db.Exec(ctx, stmt, scope, subject)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unlock clears the failures of subject like Reset, but as part of tx.
+func (repo loginAttemptRepository) Unlock(ctx context.Context, tx pgx.Tx, scope, subject string) error {
+	stmt := "DELETE FROM login_attempts WHERE scope = $1 AND subject = $2;"
+
+	_, err := tx.Exec(ctx, stmt, scope, subject)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
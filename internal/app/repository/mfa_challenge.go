@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type MFAChallengeRepository interface {
+	Insert(context.Context, pgx.Tx, domain.MFAChallenge) error
+	GetForUpdate(context.Context, pgx.Tx, string) (domain.MFAChallenge, error)
+	MarkUsed(context.Context, pgx.Tx, uint) error
+}
+
+type mfaChallengeRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewMFAChallengeRepository(db *pgxpool.Pool) mfaChallengeRepository {
+	return mfaChallengeRepository{db}
+}
+
+func (repo mfaChallengeRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.MFAChallenge) error {
+	stmt := "INSERT INTO mfa_challenges(user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4);"
+
+	_, err := tx.Exec(ctx, stmt, data.UserID, data.Purpose, data.TokenHash, data.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo mfaChallengeRepository) GetForUpdate(ctx context.Context, tx pgx.Tx, tokenHash string) (domain.MFAChallenge, error) {
+	stmt := "SELECT id, user_id, purpose, token_hash, expires_at, used_at FROM mfa_challenges WHERE token_hash = $1 FOR UPDATE;"
+	var challenge domain.MFAChallenge
+	err := tx.QueryRow(ctx, stmt, tokenHash).Scan(&challenge.ID, &challenge.UserID, &challenge.Purpose, &challenge.TokenHash, &challenge.ExpiresAt, &challenge.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return challenge, helpers.ErrInvalidMFAToken
+		}
+		return challenge, err
+	}
+
+	return challenge, nil
+}
+
+func (repo mfaChallengeRepository) MarkUsed(ctx context.Context, tx pgx.Tx, challengeID uint) error {
+	stmt := "UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1;"
+
+	_, err := tx.Exec(ctx, stmt, challengeID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type NonceRepository interface {
+	Insert(context.Context, uint, string, time.Time) (bool, error)
+	DeleteExpired(context.Context) (int64, error)
+}
+
+type nonceRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewNonceRepository(db *pgxpool.Pool) nonceRepository {
+	return nonceRepository{db}
+}
+
+// Insert remembers nonce for the key until expiresAt. It reports false when
+// the nonce was already used, i.e. the request is a replay.
+func (repo nonceRepository) Insert(ctx context.Context, keyID uint, nonce string, expiresAt time.Time) (bool, error) {
+	stmt := "INSERT INTO request_nonces(api_key_id, nonce, expires_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;"
+
+	tag, err := repo.db.Exec(ctx, stmt, keyID, nonce, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (repo nonceRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	stmt := "DELETE FROM request_nonces WHERE expires_at < NOW();"
+
+	tag, err := repo.db.Exec(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PasswordResetRepository interface {
+	Insert(context.Context, pgx.Tx, domain.OneTimeToken) error
+	GetForUpdate(context.Context, pgx.Tx, string) (domain.OneTimeToken, error)
+	InvalidateByUserID(context.Context, pgx.Tx, uint) error
+}
+
+type passwordResetRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPasswordResetRepository(db *pgxpool.Pool) passwordResetRepository {
+	return passwordResetRepository{db}
+}
+
+func (repo passwordResetRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.OneTimeToken) error {
+	stmt := "INSERT INTO password_reset_tokens(user_id, token_hash, expires_at) VALUES ($1, $2, $3);"
+
+	_, err := tx.Exec(ctx, stmt, data.UserID, data.TokenHash, data.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo passwordResetRepository) GetForUpdate(ctx context.Context, tx pgx.Tx, tokenHash string) (domain.OneTimeToken, error) {
+	stmt := "SELECT id, user_id, token_hash, expires_at, used_at FROM password_reset_tokens WHERE token_hash = $1 FOR UPDATE;"
+	var token domain.OneTimeToken
+	err := tx.QueryRow(ctx, stmt, tokenHash).Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &token.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return token, helpers.ErrInvalidResetToken
+		}
+		return token, err
+	}
+
+	return token, nil
+}
+
+// InvalidateByUserID marks every outstanding reset token of the user as used.
+func (repo passwordResetRepository) InvalidateByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
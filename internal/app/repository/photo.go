@@ -10,6 +10,9 @@ import (
 
 type PhotoRepository interface {
 	InsertBatch(context.Context, pgx.Tx, []domain.Photo) error
+	DeleteByUserID(context.Context, pgx.Tx, uint) error
+	RestoreByUserID(context.Context, pgx.Tx, uint) error
+	PurgeByUserID(context.Context, pgx.Tx, uint) error
 }
 
 type photoRepository struct {
@@ -36,3 +39,36 @@ func (repo photoRepository) InsertBatch(ctx context.Context, tx pgx.Tx, data []d
 
 	return nil
 }
+
+func (repo photoRepository) DeleteByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE photos SET deleted_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND deleted_at IS NULL;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo photoRepository) RestoreByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE photos SET deleted_at = NULL, updated_at = NOW() WHERE user_id = $1 AND deleted_at IS NOT NULL;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo photoRepository) PurgeByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "DELETE FROM photos WHERE user_id = $1;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SessionRepository interface {
+	Insert(context.Context, pgx.Tx, domain.Session) (uint, error)
+	InsertRefreshToken(context.Context, pgx.Tx, uint, string) error
+	GetByRefreshTokenForUpdate(context.Context, pgx.Tx, string) (domain.Session, domain.RefreshToken, error)
+	MarkRefreshTokenUsed(context.Context, pgx.Tx, uint) error
+	Touch(context.Context, pgx.Tx, uint) error
+	GetByID(context.Context, uint) (domain.Session, error)
+	GetActiveByUserID(context.Context, uint) ([]domain.Session, error)
+	Revoke(context.Context, pgx.Tx, uint, uint) error
+	RevokeAllByUserID(context.Context, pgx.Tx, uint) error
+}
+
+type sessionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepository(db *pgxpool.Pool) sessionRepository {
+	return sessionRepository{db}
+}
+
+func (repo sessionRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.Session) (uint, error) {
+	stmt := "INSERT INTO sessions(user_id, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4) RETURNING id;"
+	var id uint
+	err := tx.QueryRow(ctx, stmt, data.UserID, data.UserAgent, data.IP, data.ExpiresAt).Scan(&id)
+	if err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+func (repo sessionRepository) InsertRefreshToken(ctx context.Context, tx pgx.Tx, sessionID uint, tokenHash string) error {
+	stmt := "INSERT INTO refresh_tokens(session_id, token_hash) VALUES ($1, $2);"
+
+	_, err := tx.Exec(ctx, stmt, sessionID, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo sessionRepository) GetByRefreshTokenForUpdate(ctx context.Context, tx pgx.Tx, tokenHash string) (domain.Session, domain.RefreshToken, error) {
+	stmt := `SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_used_at, s.expires_at, s.revoked_at, rt.id, rt.used_at
+			FROM refresh_tokens rt
+			JOIN sessions s ON s.id = rt.session_id
+			JOIN users u ON u.id = s.user_id AND u.deleted_at IS NULL
+			WHERE rt.token_hash = $1
+			FOR UPDATE OF rt, s;`
+	var session domain.Session
+	var token domain.RefreshToken
+	err := tx.QueryRow(ctx, stmt, tokenHash).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt, &token.ID, &token.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return session, token, helpers.ErrInvalidRefreshToken
+		}
+		return session, token, err
+	}
+	token.SessionID = session.ID
+
+	return session, token, nil
+}
+
+func (repo sessionRepository) MarkRefreshTokenUsed(ctx context.Context, tx pgx.Tx, tokenID uint) error {
+	stmt := "UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1;"
+
+	_, err := tx.Exec(ctx, stmt, tokenID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo sessionRepository) Touch(ctx context.Context, tx pgx.Tx, sessionID uint) error {
+	stmt := "UPDATE sessions SET last_used_at = NOW() WHERE id = $1;"
+
+	_, err := tx.Exec(ctx, stmt, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo sessionRepository) GetByID(ctx context.Context, sessionID uint) (domain.Session, error) {
+	stmt := "SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at FROM sessions WHERE id = $1;"
+	var session domain.Session
+	err := repo.db.QueryRow(ctx, stmt, sessionID).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return session, helpers.ErrSessionNotFound
+		}
+		return session, err
+	}
+
+	return session, nil
+}
+
+func (repo sessionRepository) GetActiveByUserID(ctx context.Context, userID uint) ([]domain.Session, error) {
+	stmt := `SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at
+	FROM sessions
+	WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	ORDER BY last_used_at DESC;`
+	var sessions []domain.Session
+	rows, err := repo.db.Query(ctx, stmt, userID)
+	if err != nil {
+		return sessions, err
+	}
+
+	for rows.Next() {
+		var session domain.Session
+		err = rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (repo sessionRepository) Revoke(ctx context.Context, tx pgx.Tx, sessionID, userID uint) error {
+	stmt := "UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;"
+
+	cmd, err := tx.Exec(ctx, stmt, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return helpers.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (repo sessionRepository) RevokeAllByUserID(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;"
+
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
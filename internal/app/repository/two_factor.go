@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TwoFactorRepository interface {
+	GetForUpdate(context.Context, pgx.Tx, uint) (domain.TOTP, error)
+	SetSecret(context.Context, pgx.Tx, uint, []byte) error
+	Enable(context.Context, pgx.Tx, uint, int64) error
+	UpdateLastStep(context.Context, pgx.Tx, uint, int64) error
+	Reset(context.Context, pgx.Tx, uint) error
+	ReplaceRecoveryCodes(context.Context, pgx.Tx, uint, []string) error
+	UseRecoveryCode(context.Context, pgx.Tx, uint, string) error
+}
+
+type twoFactorRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTwoFactorRepository(db *pgxpool.Pool) twoFactorRepository {
+	return twoFactorRepository{db}
+}
+
+func (repo twoFactorRepository) GetForUpdate(ctx context.Context, tx pgx.Tx, userID uint) (domain.TOTP, error) {
+	stmt := "SELECT id, totp_secret, totp_enabled_at, totp_last_step FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;"
+	var totp domain.TOTP
+	err := tx.QueryRow(ctx, stmt, userID).Scan(&totp.UserID, &totp.Secret, &totp.EnabledAt, &totp.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return totp, helpers.ErrUserNotFound
+		}
+		return totp, err
+	}
+
+	return totp, nil
+}
+
+// SetSecret stores a secret awaiting confirmation, replacing any earlier
+// unconfirmed one.
+func (repo twoFactorRepository) SetSecret(ctx context.Context, tx pgx.Tx, userID uint, secret []byte) error {
+	stmt := "UPDATE users SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $2 AND deleted_at IS NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (repo twoFactorRepository) Enable(ctx context.Context, tx pgx.Tx, userID uint, step int64) error {
+	stmt := "UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1 WHERE id = $2 AND totp_secret IS NOT NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, step, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (repo twoFactorRepository) UpdateLastStep(ctx context.Context, tx pgx.Tx, userID uint, step int64) error {
+	stmt := "UPDATE users SET totp_last_step = $1 WHERE id = $2;"
+
+	_, err := tx.Exec(ctx, stmt, step, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reset turns two-factor authentication off and drops the recovery codes.
+func (repo twoFactorRepository) Reset(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1 AND deleted_at IS NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrUserNotFound
+	}
+
+	stmt = "DELETE FROM recovery_codes WHERE user_id = $1;"
+	_, err = tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uint, codeHashes []string) error {
+	stmt := "DELETE FROM recovery_codes WHERE user_id = $1;"
+	_, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	stmt = "INSERT INTO recovery_codes(user_id, code_hash) SELECT $1, unnest($2::TEXT[]);"
+	_, err = tx.Exec(ctx, stmt, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the matching unused code as used.
+func (repo twoFactorRepository) UseRecoveryCode(ctx context.Context, tx pgx.Tx, userID uint, codeHash string) error {
+	stmt := "UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;"
+
+	tag, err := tx.Exec(ctx, stmt, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helpers.ErrInvalidMFACode
+	}
+
+	return nil
+}
@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"kazokku/internal/app/delivery/dto"
 	"kazokku/internal/domain"
 	"kazokku/internal/helpers"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,7 +17,16 @@ type UserRepository interface {
 	Insert(context.Context, pgx.Tx, domain.User) (uint, error)
 	GetAll(context.Context, dto.UserQuery) ([]domain.User, error)
 	GetByID(context.Context, uint) (domain.User, error)
-	Update(context.Context, pgx.Tx, uint, domain.User) error
+	GetByEmail(context.Context, string) (domain.User, error)
+	GetForUpdate(context.Context, pgx.Tx, uint) (domain.User, error)
+	EmailExists(context.Context, pgx.Tx, string) (bool, error)
+	ConfirmEmail(context.Context, pgx.Tx, uint, string) (uint, error)
+	UpdatePassword(context.Context, pgx.Tx, uint, string) error
+	Update(context.Context, pgx.Tx, uint, domain.User) (uint, error)
+	Delete(context.Context, pgx.Tx, uint) error
+	Restore(context.Context, pgx.Tx, uint) error
+	GetDeletedBefore(context.Context, time.Time) ([]uint, error)
+	Purge(context.Context, pgx.Tx, uint, time.Time) error
 }
 
 type userRepository struct {
@@ -38,30 +49,43 @@ func (repo userRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.Us
 }
 
 func (repo userRepository) GetAll(ctx context.Context, query dto.UserQuery) ([]domain.User, error) {
-	stmt := fmt.Sprintf(`SELECT u.id, u.name, u.email, u.address, cc.type, cc.number, cc.name, cc.expired
+	var args []any
+	var createdFilter string
+	if query.CreatedFrom != "" {
+		args = append(args, query.CreatedFrom)
+		createdFilter += fmt.Sprintf(" AND u.created_at >= $%d", len(args))
+	}
+	if query.CreatedTo != "" {
+		args = append(args, query.CreatedTo)
+		createdFilter += fmt.Sprintf(" AND u.created_at <= $%d", len(args))
+	}
+	args = append(args, query.Query)
+	search := len(args)
+
+	// order by and sort by are checked against a list of columns and
+	// directions, everything else is bound
+	stmt := fmt.Sprintf(`SELECT u.id, u.name, u.email, u.address, u.email_verified_at, u.created_at, u.updated_at
 	FROM users u
-	JOIN credit_cards cc ON cc.user_id = u.id
-	WHERE u.name ILIKE '%%%s%%'
-	OR u.email ILIKE '%%%s%%'
-	OR u.address ILIKE '%%%s%%'
+	WHERE u.deleted_at IS NULL%s
+	AND (u.name ILIKE '%%' || $%d || '%%'
+	OR u.email ILIKE '%%' || $%d || '%%'
+	OR u.address ILIKE '%%' || $%d || '%%')
 	ORDER BY u.%s %s
 	OFFSET %d
-	LIMIT %d;`, query.Query, query.Query, query.Query, query.OrderBy, query.SortBy, query.Offset, query.Limit)
+	LIMIT %d;`, createdFilter, search, search, search, query.OrderBy, query.SortBy, query.Offset, query.Limit)
 	var users []domain.User
 	var ids []uint
-	rows, err := repo.db.Query(ctx, stmt)
+	rows, err := repo.db.Query(ctx, stmt, args...)
 	if err != nil {
 		return users, err
 	}
 
 	for rows.Next() {
 		var user domain.User
-		var cc domain.CreditCard
-		err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.Address, &cc.Type, &cc.Number, &cc.Name, &cc.Expired)
+		err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
 			return users, err
 		}
-		user.CreditCard = cc
 		users = append(users, user)
 		ids = append(ids, user.ID)
 	}
@@ -72,7 +96,7 @@ func (repo userRepository) GetAll(ctx context.Context, query dto.UserQuery) ([]d
 
 	idsStr := helpers.JoinIDs(ids)
 	// get photos
-	stmt = fmt.Sprintf(`SELECT user_id, filename FROM photos WHERE user_id IN (%s);`, idsStr)
+	stmt = fmt.Sprintf(`SELECT user_id, filename, created_at FROM photos WHERE user_id IN (%s) AND deleted_at IS NULL;`, idsStr)
 	rows, err = repo.db.Query(ctx, stmt)
 	if err != nil {
 		return users, err
@@ -81,7 +105,7 @@ func (repo userRepository) GetAll(ctx context.Context, query dto.UserQuery) ([]d
 	for rows.Next() {
 		var photo domain.Photo
 		var userID uint
-		err = rows.Scan(&userID, &photo.Filepath)
+		err = rows.Scan(&userID, &photo.Filepath, &photo.CreatedAt)
 		if err != nil {
 			return users, err
 		}
@@ -97,11 +121,10 @@ func (repo userRepository) GetAll(ctx context.Context, query dto.UserQuery) ([]d
 }
 
 func (repo userRepository) GetByID(ctx context.Context, userID uint) (domain.User, error) {
-	stmt := `SELECT u.id, u.name, email, address, p.filename, cc.type, cc.number, cc.name, cc.expired
+	stmt := `SELECT u.id, u.version, u.name, email, address, u.email_verified_at, u.created_at, u.updated_at, p.filename, p.created_at
 			FROM users u
-			LEFT JOIN photos p ON p.user_id = u.id
-			LEFT JOIN credit_cards cc ON cc.user_id = u.id
-			WHERE u.id = $1;`
+			LEFT JOIN photos p ON p.user_id = u.id AND p.deleted_at IS NULL
+			WHERE u.id = $1 AND u.deleted_at IS NULL;`
 	var user domain.User
 	rows, err := repo.db.Query(ctx, stmt, userID)
 	if err != nil {
@@ -109,21 +132,159 @@ func (repo userRepository) GetByID(ctx context.Context, userID uint) (domain.Use
 	}
 	for rows.Next() {
 		var photo domain.Photo
-		var cc domain.CreditCard
-		err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.Address, &photo.Filepath, &cc.Type, &cc.Number, &cc.Name, &cc.Expired)
+		err = rows.Scan(&user.ID, &user.Version, &user.Name, &user.Email, &user.Address, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt, &photo.Filepath, &photo.CreatedAt)
 		if err != nil {
 			return user, err
 		}
 		user.Photos = append(user.Photos, photo)
-		user.CreditCard = cc
 	}
 	return user, nil
 }
 
-func (repo userRepository) Update(ctx context.Context, tx pgx.Tx, userID uint, data domain.User) error {
-	stmt := "UPDATE users SET name = COALESCE($1, name), address = COALESCE($2, address), email = COALESCE($3, email), password = COALESCE($4, password) WHERE id = $5;"
+func (repo userRepository) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	stmt := "SELECT id, name, email, address, password, totp_enabled_at FROM users WHERE email = $1 AND deleted_at IS NULL;"
+	var user domain.User
+	err := repo.db.QueryRow(ctx, stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Password, &user.TOTPEnabledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, helpers.ErrUserNotFound
+		}
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (repo userRepository) GetForUpdate(ctx context.Context, tx pgx.Tx, userID uint) (domain.User, error) {
+	stmt := `SELECT u.id, u.version, u.name, u.email, u.address, COALESCE(cc.id, 0), cc.type, cc.name, cc.expired, cc.token, cc.last4, COALESCE(cc.is_default, FALSE)
+			FROM users u
+			LEFT JOIN credit_cards cc ON cc.user_id = u.id AND cc.is_default AND cc.deleted_at IS NULL
+			WHERE u.id = $1 AND u.deleted_at IS NULL
+			FOR UPDATE OF u;`
+	var user domain.User
+	var cc domain.CreditCard
+	err := tx.QueryRow(ctx, stmt, userID).Scan(&user.ID, &user.Version, &user.Name, &user.Email, &user.Address, &cc.ID, &cc.Type, &cc.Name, &cc.Expired, &cc.Token, &cc.Last4, &cc.IsDefault)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, helpers.ErrUserNotFound
+		}
+		return user, err
+	}
+	user.CreditCard = cc
+
+	return user, nil
+}
+
+// Update applies data to the user only if its stored version still equals
+// data.Version, and returns the incremented version.
+func (repo userRepository) Update(ctx context.Context, tx pgx.Tx, userID uint, data domain.User) (uint, error) {
+	stmt := "UPDATE users SET name = COALESCE($1, name), address = COALESCE($2, address), email = COALESCE($3, email), password = COALESCE($4, password), version = version + 1, updated_at = NOW() WHERE id = $5 AND deleted_at IS NULL AND version = $6 RETURNING version;"
+
+	var version uint
+	err := tx.QueryRow(ctx, stmt, data.Name, data.Address, data.Email, data.Password, userID, data.Version).Scan(&version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return version, helpers.ErrPreconditionFailed
+		}
+		return version, err
+	}
+
+	return version, nil
+}
+
+func (repo userRepository) EmailExists(ctx context.Context, tx pgx.Tx, email string) (bool, error) {
+	stmt := "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1);"
+	var exists bool
+	err := tx.QueryRow(ctx, stmt, email).Scan(&exists)
+	if err != nil {
+		return exists, err
+	}
+
+	return exists, nil
+}
+
+// ConfirmEmail sets the user's email to a verified address and returns the
+// incremented version.
+func (repo userRepository) ConfirmEmail(ctx context.Context, tx pgx.Tx, userID uint, email string) (uint, error) {
+	stmt := "UPDATE users SET email = $1, email_verified_at = NOW(), version = version + 1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL RETURNING version;"
+
+	var version uint
+	err := tx.QueryRow(ctx, stmt, email, userID).Scan(&version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return version, helpers.ErrUserNotFound
+		}
+		return version, err
+	}
+
+	return version, nil
+}
+
+// UpdatePassword replaces the stored hash of an unchanged password, e.g.
+// after upgrading its hashing scheme. It is not a user visible change, so
+// version and updated_at are left alone.
+func (repo userRepository) UpdatePassword(ctx context.Context, tx pgx.Tx, userID uint, hash string) error {
+	stmt := "UPDATE users SET password = $1 WHERE id = $2;"
+
+	_, err := tx.Exec(ctx, stmt, hash, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo userRepository) Delete(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE users SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL;"
+
+	cmd, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return helpers.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (repo userRepository) Restore(ctx context.Context, tx pgx.Tx, userID uint) error {
+	stmt := "UPDATE users SET deleted_at = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NOT NULL;"
+
+	cmd, err := tx.Exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return helpers.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (repo userRepository) GetDeletedBefore(ctx context.Context, before time.Time) ([]uint, error) {
+	stmt := "SELECT id FROM users WHERE deleted_at < $1;"
+	var ids []uint
+	rows, err := repo.db.Query(ctx, stmt, before)
+	if err != nil {
+		return ids, err
+	}
+
+	for rows.Next() {
+		var id uint
+		if err = rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (repo userRepository) Purge(ctx context.Context, tx pgx.Tx, userID uint, before time.Time) error {
+	stmt := "DELETE FROM users WHERE id = $1 AND deleted_at < $2;"
 
-	cmd, err := tx.Exec(ctx, stmt, data.Name, data.Address, data.Email, data.Password, userID)
+	cmd, err := tx.Exec(ctx, stmt, userID, before)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"kazokku/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type VaultRepository interface {
+	Insert(context.Context, pgx.Tx, domain.VaultEntry) error
+	Delete(context.Context, pgx.Tx, string) error
+	GetSealedForUpdate(context.Context, pgx.Tx, uint, string, int) ([]domain.VaultEntry, error)
+	UpdateSealed(context.Context, pgx.Tx, uint, domain.Envelope) error
+	CountSealedNotUnder(context.Context, string) (int64, error)
+}
+
+type vaultRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewVaultRepository(db *pgxpool.Pool) vaultRepository {
+	return vaultRepository{db}
+}
+
+func (repo vaultRepository) Insert(ctx context.Context, tx pgx.Tx, data domain.VaultEntry) error {
+	stmt := "INSERT INTO card_vault(token, key_id, data_key, nonce, ciphertext) VALUES ($1, $2, $3, $4, $5);"
+
+	_, err := tx.Exec(ctx, stmt, data.Token, data.Sealed.KeyID, data.Sealed.DataKey, data.Sealed.Nonce, data.Sealed.Ciphertext)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo vaultRepository) Delete(ctx context.Context, tx pgx.Tx, token string) error {
+	stmt := "DELETE FROM card_vault WHERE token = $1;"
+
+	_, err := tx.Exec(ctx, stmt, token)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSealedForUpdate locks up to limit entries after afterID that are
+// sealed under a master key other than keyID.
+func (repo vaultRepository) GetSealedForUpdate(ctx context.Context, tx pgx.Tx, afterID uint, keyID string, limit int) ([]domain.VaultEntry, error) {
+	stmt := `SELECT id, token, key_id, data_key, nonce, ciphertext
+	FROM card_vault
+	WHERE id > $1 AND key_id <> $2
+	ORDER BY id
+	LIMIT $3
+	FOR UPDATE;`
+	var entries []domain.VaultEntry
+	rows, err := tx.Query(ctx, stmt, afterID, keyID, limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry domain.VaultEntry
+		err = rows.Scan(&entry.ID, &entry.Token, &entry.Sealed.KeyID, &entry.Sealed.DataKey, &entry.Sealed.Nonce, &entry.Sealed.Ciphertext)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (repo vaultRepository) UpdateSealed(ctx context.Context, tx pgx.Tx, entryID uint, sealed domain.Envelope) error {
+	stmt := "UPDATE card_vault SET key_id = $1, data_key = $2, nonce = $3, ciphertext = $4 WHERE id = $5;"
+
+	_, err := tx.Exec(ctx, stmt, sealed.KeyID, sealed.DataKey, sealed.Nonce, sealed.Ciphertext, entryID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo vaultRepository) CountSealedNotUnder(ctx context.Context, keyID string) (int64, error) {
+	stmt := "SELECT COUNT(*) FROM card_vault WHERE key_id <> $1;"
+	var count int64
+	err := repo.db.QueryRow(ctx, stmt, keyID).Scan(&count)
+	if err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ApiKeyService interface {
+	Create(ctx *fiber.Ctx, data dto.ApiKeyRequest) (dto.ApiKeySecretResponse, error)
+	GetAll(ctx *fiber.Ctx) ([]dto.ApiKeyResponse, error)
+	Rotate(ctx *fiber.Ctx, keyID uint) (dto.ApiKeySecretResponse, error)
+	UpdateScopes(ctx *fiber.Ctx, keyID uint, data dto.ApiKeyScopesRequest) error
+	UpdateRole(ctx *fiber.Ctx, keyID uint, data dto.ApiKeyRoleRequest) error
+	Revoke(ctx *fiber.Ctx, keyID uint) error
+}
+
+type apiKeyService struct {
+	db         *pgxpool.Pool
+	apiKeyRepo repository.ApiKeyRepository
+	auditRepo  repository.AuditRepository
+	hmacSecret string
+	logger     *slog.Logger
+}
+
+func NewApiKeyService(db *pgxpool.Pool, logger *slog.Logger, hmacSecret string, apiKeyRepo repository.ApiKeyRepository, auditRepo repository.AuditRepository) ApiKeyService {
+	return apiKeyService{
+		db:         db,
+		apiKeyRepo: apiKeyRepo,
+		auditRepo:  auditRepo,
+		hmacSecret: hmacSecret,
+		logger:     logger,
+	}
+}
+
+func (s apiKeyService) Create(ctx *fiber.Ctx, data dto.ApiKeyRequest) (dto.ApiKeySecretResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.ApiKeySecretResponse
+	if err := data.Validate(); err != nil {
+		return resp, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	var expiresAt sql.NullTime
+	if data.ExpiresAt != "" {
+		expiresAt.Time, _ = time.Parse(time.RFC3339, data.ExpiresAt)
+		expiresAt.Valid = true
+	}
+
+	if data.AuthMode == "" {
+		data.AuthMode = domain.AuthModeBearer
+	}
+
+	if len(data.Scopes) == 0 {
+		data.Scopes = domain.RoleScopes[data.Role]
+	}
+
+	if data.AuthMode == domain.AuthModeHMAC && s.hmacSecret == "" {
+		return resp, helpers.NewResponseError(helpers.ErrHMACDisabled, fiber.StatusBadRequest)
+	}
+
+	key, salt, err := generateApiKeyAndSalt()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating api key", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// create api key record
+	apiKey := domain.ApiKey{
+		Name:      data.Name,
+		Owner:     data.Owner,
+		KeyHash:   helpers.HashToken(key),
+		Scopes:    data.Scopes,
+		Role:      data.Role,
+		AuthMode:  data.AuthMode,
+		HMACSalt:  salt,
+		ExpiresAt: expiresAt,
+	}
+	id, err := s.apiKeyRepo.Insert(ctx.Context(), tx, apiKey)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting api key", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditApiKeyCreated,
+		TargetType: domain.TargetApiKey,
+		TargetID:   id,
+		Changes:    helpers.ApiKeyChanges(domain.ApiKey{}, apiKey),
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return s.secretResponse(id, data.AuthMode, key, salt), nil
+}
+
+func (s apiKeyService) GetAll(ctx *fiber.Ctx) ([]dto.ApiKeyResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var keys []dto.ApiKeyResponse
+
+	data, err := s.apiKeyRepo.GetAll(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting api keys", "error", err, "request_id", requestID)
+		return keys, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	for _, key := range data {
+		keys = append(keys, dto.ApiKeyResponse{
+			ID:         key.ID,
+			Name:       key.Name,
+			Owner:      key.Owner,
+			Scopes:     key.Scopes,
+			Role:       key.Role,
+			AuthMode:   key.AuthMode,
+			CreatedAt:  key.CreatedAt,
+			RotatedAt:  nullTimeToPtr(key.RotatedAt),
+			ExpiresAt:  nullTimeToPtr(key.ExpiresAt),
+			LastUsedAt: nullTimeToPtr(key.LastUsedAt),
+			RevokedAt:  nullTimeToPtr(key.RevokedAt),
+		})
+	}
+
+	return keys, nil
+}
+
+// Rotate issues a new plaintext and signing secret for an existing key. The
+// previous ones stop working at once, while name, owner and expiry are kept.
+func (s apiKeyService) Rotate(ctx *fiber.Ctx, keyID uint) (dto.ApiKeySecretResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.ApiKeySecretResponse
+
+	current, err := s.apiKeyRepo.GetByID(ctx.Context(), keyID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrApiKeyNotFound) {
+			return resp, helpers.NewResponseError(helpers.ErrApiKeyNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting api key", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if current.AuthMode == domain.AuthModeHMAC && s.hmacSecret == "" {
+		return resp, helpers.NewResponseError(helpers.ErrHMACDisabled, fiber.StatusBadRequest)
+	}
+
+	key, salt, err := generateApiKeyAndSalt()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating api key", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// replace api key hash
+	err = s.apiKeyRepo.Rotate(ctx.Context(), tx, keyID, helpers.HashToken(key), salt)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrApiKeyNotFound) {
+			return resp, helpers.NewResponseError(helpers.ErrApiKeyNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error rotating api key", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	rotated := current
+	rotated.KeyHash = helpers.HashToken(key)
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditApiKeyRotated,
+		TargetType: domain.TargetApiKey,
+		TargetID:   keyID,
+		Changes:    helpers.ApiKeyChanges(current, rotated),
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	// cached lookups may hold the old row until the change is visible
+	s.apiKeyRepo.Invalidate()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return s.secretResponse(keyID, current.AuthMode, key, salt), nil
+}
+
+func (s apiKeyService) UpdateScopes(ctx *fiber.Ctx, keyID uint, data dto.ApiKeyScopesRequest) error {
+	requestID := ctx.Context().Value("requestid")
+	if err := data.Validate(); err != nil {
+		return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	current, err := s.apiKeyRepo.GetByID(ctx.Context(), keyID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrApiKeyNotFound) {
+			return helpers.NewResponseError(helpers.ErrApiKeyNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting api key", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	for _, scope := range data.Scopes {
+		if !domain.RoleAllows(current.Role, scope) {
+			return helpers.NewResponseError(helpers.ErrScopeNotAllowed, fiber.StatusBadRequest)
+		}
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// replace api key scopes
+	err = s.apiKeyRepo.UpdateScopes(ctx.Context(), tx, keyID, data.Scopes)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrApiKeyNotFound) {
+			return helpers.NewResponseError(helpers.ErrApiKeyNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error updating api key scopes", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	updated := current
+	updated.Scopes = data.Scopes
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditApiKeyScopesUpdated,
+		TargetType: domain.TargetApiKey,
+		TargetID:   keyID,
+		Changes:    helpers.ApiKeyChanges(current, updated),
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	// cached lookups may hold the old row until the change is visible
+	s.apiKeyRepo.Invalidate()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// UpdateRole binds the key to another role. Its scopes are reset to
+// everything the new role allows, which UpdateScopes can narrow again.
+func (s apiKeyService) UpdateRole(ctx *fiber.Ctx, keyID uint, data dto.ApiKeyRoleRequest) error {
+	requestID := ctx.Context().Value("requestid")
+	if err := data.Validate(); err != nil {
+		return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	current, err := s.apiKeyRepo.GetByID(ctx.Context(), keyID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrApiKeyNotFound) {
+			return helpers.NewResponseError(helpers.ErrApiKeyNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting api key", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// replace api key role and scopes
+	err = s.apiKeyRepo.UpdateRole(ctx.Context(), tx, keyID, data.Role, domain.RoleScopes[data.Role])
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrApiKeyNotFound) {
+			return helpers.NewResponseError(helpers.ErrApiKeyNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error updating api key role", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	updated := current
+	updated.Role, updated.Scopes = data.Role, domain.RoleScopes[data.Role]
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditApiKeyRoleUpdated,
+		TargetType: domain.TargetApiKey,
+		TargetID:   keyID,
+		Changes:    helpers.ApiKeyChanges(current, updated),
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	// cached lookups may hold the old row until the change is visible
+	s.apiKeyRepo.Invalidate()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func (s apiKeyService) Revoke(ctx *fiber.Ctx, keyID uint) error {
+	requestID := ctx.Context().Value("requestid")
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// revoke api key record
+	err = s.apiKeyRepo.Revoke(ctx.Context(), tx, keyID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrApiKeyNotFound) {
+			return helpers.NewResponseError(helpers.ErrApiKeyNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error revoking api key", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditApiKeyRevoked,
+		TargetType: domain.TargetApiKey,
+		TargetID:   keyID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	// cached lookups may hold the old row until the change is visible
+	s.apiKeyRepo.Invalidate()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// secretResponse reveals the credential a client uses for the key: the
+// plaintext key in bearer mode or the derived signing secret in hmac mode.
+func (s apiKeyService) secretResponse(keyID uint, authMode, key, salt string) dto.ApiKeySecretResponse {
+	if authMode == domain.AuthModeHMAC {
+		return dto.ApiKeySecretResponse{ID: keyID, Secret: helpers.DeriveHMACSecret(s.hmacSecret, salt)}
+	}
+
+	return dto.ApiKeySecretResponse{ID: keyID, Key: key}
+}
+
+func generateApiKeyAndSalt() (string, string, error) {
+	key, err := helpers.GenerateApiKey()
+	if err != nil {
+		return "", "", err
+	}
+
+	salt, err := helpers.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, salt, nil
+}
+
+// IssueApiKey stores a bearer key created outside of a request, such as the
+// first administrator key, and returns its id and plaintext. When plaintext
+// is empty a new key is generated. The event is recorded as done by the
+// system.
+func IssueApiKey(ctx context.Context, db *pgxpool.Pool, apiKeyRepo repository.ApiKeyRepository, auditRepo repository.AuditRepository, data dto.ApiKeyRequest, plaintext string) (uint, string, error) {
+	if err := data.Validate(); err != nil {
+		return 0, "", err
+	}
+
+	if len(data.Scopes) == 0 {
+		data.Scopes = domain.RoleScopes[data.Role]
+	}
+
+	key, salt, err := generateApiKeyAndSalt()
+	if err != nil {
+		return 0, "", err
+	}
+	if plaintext != "" {
+		key = plaintext
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+
+	apiKey := domain.ApiKey{
+		Name:     data.Name,
+		Owner:    data.Owner,
+		KeyHash:  helpers.HashToken(key),
+		Scopes:   data.Scopes,
+		Role:     data.Role,
+		AuthMode: domain.AuthModeBearer,
+		HMACSalt: salt,
+	}
+	id, err := apiKeyRepo.Insert(ctx, tx, apiKey)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, "", err
+	}
+
+	err = auditRepo.Insert(ctx, tx, domain.AuditEvent{
+		ActorType:  domain.ActorSystem,
+		Action:     domain.AuditApiKeyCreated,
+		TargetType: domain.TargetApiKey,
+		TargetID:   id,
+		Changes:    helpers.ApiKeyChanges(domain.ApiKey{}, apiKey),
+	})
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, "", err
+	}
+
+	return id, key, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+type AuditService interface {
+	GetAll(ctx *fiber.Ctx, query dto.AuditQuery) ([]dto.AuditEventResponse, error)
+}
+
+type auditService struct {
+	auditRepo repository.AuditRepository
+	logger    *slog.Logger
+}
+
+func NewAuditService(logger *slog.Logger, auditRepo repository.AuditRepository) AuditService {
+	return auditService{
+		auditRepo: auditRepo,
+		logger:    logger,
+	}
+}
+
+func (s auditService) GetAll(ctx *fiber.Ctx, query dto.AuditQuery) ([]dto.AuditEventResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var events []dto.AuditEventResponse
+	if err := authorize(ctx, domain.ScopeAuditRead); err != nil {
+		return events, err
+	}
+
+	if err := query.Validate(); err != nil {
+		return events, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = 30
+	}
+
+	data, err := s.auditRepo.GetAll(ctx.Context(), query)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting audit events", "error", err, "request_id", requestID)
+		return events, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	principal, _ := ctx.Locals("principal").(domain.Principal)
+	for _, event := range data {
+		resp := auditEventResponse(event)
+		// card changes are only shown to callers allowed to see cards
+		if !principal.HasScope(domain.ScopeCardsReadMasked) {
+			changes := resp.Changes[:0]
+			for _, change := range resp.Changes {
+				if !strings.HasPrefix(change.Field, "creditcard_") {
+					changes = append(changes, change)
+				}
+			}
+			resp.Changes = changes
+		}
+
+		events = append(events, resp)
+	}
+
+	return events, nil
+}
+
+func auditEventResponse(event domain.AuditEvent) dto.AuditEventResponse {
+	changes := make([]dto.FieldChangeResponse, 0, len(event.Changes))
+	for _, change := range event.Changes {
+		changes = append(changes, dto.FieldChangeResponse{
+			Field: change.Field,
+			Old:   change.Old,
+			New:   change.New,
+		})
+	}
+
+	var actorID *uint
+	if event.ActorID != 0 {
+		actorID = &event.ActorID
+	}
+
+	return dto.AuditEventResponse{
+		ID:         event.ID,
+		ActorType:  event.ActorType,
+		ActorID:    actorID,
+		RequestID:  event.RequestID,
+		IP:         event.IP,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Changes:    changes,
+		CreatedAt:  event.CreatedAt,
+	}
+}
+
+// requestActor returns who is making the request, from the principal the
+// auth middleware stored.
+func requestActor(ctx *fiber.Ctx) (string, uint) {
+	principal, _ := ctx.Locals("principal").(domain.Principal)
+	switch {
+	case principal.ApiKeyID != 0:
+		return domain.ActorApiKey, principal.ApiKeyID
+	case principal.UserID != 0:
+		return domain.ActorUser, principal.UserID
+	default:
+		return domain.ActorAnonymous, 0
+	}
+}
+
+// recordAudit stores event in tx together with the request it came from.
+// Unless the event names its actor, the principal of the request is taken,
+// or an anonymous caller when there is none. The caller owns tx.
+func recordAudit(ctx *fiber.Ctx, tx pgx.Tx, logger *slog.Logger, auditRepo repository.AuditRepository, event domain.AuditEvent) error {
+	requestID := ctx.Context().Value("requestid")
+
+	if event.ActorType == "" {
+		event.ActorType, event.ActorID = requestActor(ctx)
+	}
+	event.RequestID, _ = requestID.(string)
+	event.IP = ctx.IP()
+
+	if err := auditRepo.Insert(ctx.Context(), tx, event); err != nil {
+		logger.ErrorContext(ctx.Context(), "error inserting audit event", "error", err, "action", event.Action, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
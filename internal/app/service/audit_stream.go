@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"kazokku/internal/app/repository"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	auditStreamBatch = 500
+
+	// ids are taken when an event is written but become visible on commit,
+	// so events are only streamed once no transaction can still be writing
+	// one with a lower id.
+	auditStreamLag = time.Minute
+)
+
+// AuditStreamer appends committed audit events to a JSON-lines file, one
+// event per line, for shipping to systems outside the database. It picks up
+// after the last event already in the file, so a restart neither skips nor
+// repeats events.
+type AuditStreamer struct {
+	auditRepo repository.AuditRepository
+	logger    *slog.Logger
+	path      string
+	interval  time.Duration
+}
+
+func NewAuditStreamer(logger *slog.Logger, path string, interval time.Duration, auditRepo repository.AuditRepository) AuditStreamer {
+	return AuditStreamer{
+		auditRepo: auditRepo,
+		logger:    logger,
+		path:      path,
+		interval:  interval,
+	}
+}
+
+// Run streams new events once and then every interval until ctx is done.
+func (s AuditStreamer) Run(ctx context.Context) {
+	lastID, err := s.lastStreamedID()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "error reading audit stream", "error", err, "path", s.path)
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		lastID = s.stream(ctx, lastID)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stream appends every event after lastID and returns the id of the last
+// event written.
+func (s AuditStreamer) stream(ctx context.Context, lastID uint) uint {
+	for {
+		events, err := s.auditRepo.GetAfter(ctx, lastID, time.Now().Add(-auditStreamLag), auditStreamBatch)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "error getting audit events", "error", err)
+			return lastID
+		}
+
+		if len(events) == 0 {
+			return lastID
+		}
+
+		file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "error opening audit stream", "error", err, "path", s.path)
+			return lastID
+		}
+
+		w := bufio.NewWriter(file)
+		enc := json.NewEncoder(w)
+		for _, event := range events {
+			if err = enc.Encode(auditEventResponse(event)); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err == nil {
+			err = file.Sync()
+		}
+		file.Close()
+		if err != nil {
+			s.logger.ErrorContext(ctx, "error writing audit stream", "error", err, "path", s.path)
+			return lastID
+		}
+
+		lastID = events[len(events)-1].ID
+		if len(events) < auditStreamBatch {
+			return lastID
+		}
+	}
+}
+
+// lastStreamedID returns the id of the last event in the file, or 0 when
+// there is none yet. A line left incomplete by a crash is terminated so the
+// next event starts on a line of its own.
+func (s AuditStreamer) lastStreamedID() (uint, error) {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// the last event is near the end, there is no need to read everything
+	offset := max(info.Size()-64*1024, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	if len(tail) > 0 && tail[len(tail)-1] != '\n' {
+		if _, err := file.WriteAt([]byte("\n"), info.Size()); err != nil {
+			return 0, err
+		}
+	}
+
+	lines := bytes.Split(bytes.TrimRight(tail, "\n"), []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		var event struct {
+			ID uint `json:"id"`
+		}
+		if json.Unmarshal(lines[i], &event) == nil && event.ID != 0 {
+			return event.ID, nil
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,836 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"kazokku/internal/infrastructure/mail"
+	"kazokku/internal/infrastructure/password"
+	"kazokku/internal/infrastructure/token"
+	"kazokku/internal/utils"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuthService interface {
+	Login(ctx *fiber.Ctx, data dto.LoginRequest) (dto.TokenResponse, error)
+	Refresh(ctx *fiber.Ctx, data dto.RefreshRequest) (dto.TokenResponse, error)
+	Logout(ctx *fiber.Ctx, userID, sessionID uint) error
+	GetSessions(ctx *fiber.Ctx, userID, currentSessionID uint) ([]dto.SessionResponse, error)
+	RevokeSession(ctx *fiber.Ctx, userID, sessionID uint) error
+	ForgotPassword(ctx *fiber.Ctx, data dto.ForgotPasswordRequest) error
+	ResetPassword(ctx *fiber.Ctx, data dto.ResetPasswordRequest) error
+	VerifyMFA(ctx *fiber.Ctx, data dto.MFAVerifyRequest) (dto.TokenResponse, error)
+	EnrolMFA(ctx *fiber.Ctx, data dto.MFAEnrolRequest) (dto.TOTPEnrolmentResponse, error)
+	ConfirmMFA(ctx *fiber.Ctx, data dto.MFAConfirmRequest) (dto.TokenResponse, error)
+}
+
+type authService struct {
+	db          *pgxpool.Pool
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	resetRepo   repository.PasswordResetRepository
+	historyRepo repository.HistoryRepository
+	ccRepo      repository.CreditCardRepository
+	mfaRepo     repository.MFAChallengeRepository
+	auditRepo   repository.AuditRepository
+	lockout     LockoutService
+	twoFactor   TwoFactorService
+	tokens      token.Manager
+	mailer      mail.Mailer
+	hasher      password.Hasher
+	policy      password.Policy
+	conf        utils.Config
+	logger      *slog.Logger
+}
+
+func NewAuthService(db *pgxpool.Pool, logger *slog.Logger, conf utils.Config, tokens token.Manager, mailer mail.Mailer, hasher password.Hasher, policy password.Policy, userRepo repository.UserRepository, sessionRepo repository.SessionRepository, resetRepo repository.PasswordResetRepository, historyRepo repository.HistoryRepository, ccRepo repository.CreditCardRepository, mfaRepo repository.MFAChallengeRepository, auditRepo repository.AuditRepository, lockout LockoutService, twoFactor TwoFactorService) AuthService {
+	return authService{
+		db:          db,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		resetRepo:   resetRepo,
+		historyRepo: historyRepo,
+		ccRepo:      ccRepo,
+		mfaRepo:     mfaRepo,
+		auditRepo:   auditRepo,
+		lockout:     lockout,
+		twoFactor:   twoFactor,
+		tokens:      tokens,
+		mailer:      mailer,
+		hasher:      hasher,
+		policy:      policy,
+		conf:        conf,
+		logger:      logger,
+	}
+}
+
+func (s authService) Login(ctx *fiber.Ctx, data dto.LoginRequest) (dto.TokenResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TokenResponse
+	if err := data.Validate(); err != nil {
+		return resp, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	if err := s.lockout.Check(ctx, data.Email); err != nil {
+		return resp, err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx.Context(), data.Email)
+	if err != nil {
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			// compare anyway so unknown emails take as long as wrong passwords
+			s.hasher.Verify(s.hasher.DummyHash(), data.Password)
+			s.lockout.RecordFailure(ctx, data.Email)
+			return resp, helpers.NewResponseError(helpers.ErrInvalidCredentials, fiber.StatusUnauthorized)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting user by email", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	ok, rehash := s.hasher.Verify(user.Password.String, data.Password)
+	if !ok {
+		s.lockout.RecordFailure(ctx, data.Email)
+		return resp, helpers.NewResponseError(helpers.ErrInvalidCredentials, fiber.StatusUnauthorized)
+	}
+
+	// decide whether a second factor is needed before a session is created
+	var purpose string
+	if user.TOTPEnabledAt.Valid {
+		purpose = domain.MFAPurposeVerify
+	} else if s.conf.TOTP.RequiredForCardholders {
+		holdsCard, err := s.ccRepo.ExistsByUserID(ctx.Context(), user.ID)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error checking credit card", "error", err, "request_id", requestID)
+			return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+		if holdsCard {
+			purpose = domain.MFAPurposeEnrol
+		}
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// upgrade hashes of outdated schemes while the plaintext is at hand
+	if rehash {
+		hashed, err := s.hasher.Hash(data.Password)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error hashing password", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+
+		err = s.userRepo.UpdatePassword(ctx.Context(), tx, user.ID, hashed)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error updating password hash", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+
+		err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+			ActorType:  domain.ActorUser,
+			ActorID:    user.ID,
+			Action:     domain.AuditUserUpdated,
+			TargetType: domain.TargetUser,
+			TargetID:   user.ID,
+			Changes:    []domain.FieldChange{{Field: "password"}},
+		})
+		if err != nil {
+			tx.Rollback(ctx.Context())
+			return resp, err
+		}
+	}
+
+	if purpose != "" {
+		resp, err = s.createChallenge(ctx, tx, user.ID, purpose)
+	} else {
+		resp, err = s.createSession(ctx, tx, user.ID)
+	}
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return dto.TokenResponse{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// failures are only forgiven once the login is complete, so knowing the
+	// password does not allow unlimited guesses at the second factor
+	if purpose == "" {
+		s.lockout.RecordSuccess(ctx, data.Email)
+	}
+	return resp, nil
+}
+
+// VerifyMFA completes a login of a user with two-factor authentication,
+// trading the challenge and a code or recovery code for a session.
+func (s authService) VerifyMFA(ctx *fiber.Ctx, data dto.MFAVerifyRequest) (dto.TokenResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TokenResponse
+	if err := data.Validate(); err != nil {
+		return resp, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	challenge, email, err := s.getChallenge(ctx, tx, data.MFAToken, domain.MFAPurposeVerify)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	err = s.twoFactor.Verify(ctx, tx, challenge.UserID, data)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrInvalidMFACode) {
+			s.lockout.RecordFailure(ctx, email)
+		}
+		return resp, err
+	}
+
+	err = s.mfaRepo.MarkUsed(ctx.Context(), tx, challenge.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error marking challenge used", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resp, err = s.createSession(ctx, tx, challenge.UserID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return dto.TokenResponse{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	s.lockout.RecordSuccess(ctx, email)
+	return resp, nil
+}
+
+// EnrolMFA starts the enrolment a cardholder without two-factor
+// authentication must complete before their login succeeds.
+func (s authService) EnrolMFA(ctx *fiber.Ctx, data dto.MFAEnrolRequest) (dto.TOTPEnrolmentResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TOTPEnrolmentResponse
+	if err := data.Validate(); err != nil {
+		return resp, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// the challenge is only read here, Confirm consumes it
+	challenge, _, err := s.getChallenge(ctx, tx, data.MFAToken, domain.MFAPurposeEnrol)
+	tx.Rollback(ctx.Context())
+	if err != nil {
+		return resp, err
+	}
+
+	return s.twoFactor.Enrol(ctx, challenge.UserID)
+}
+
+// ConfirmMFA completes an enrolment started by EnrolMFA and the login that
+// required it. The response carries the recovery codes next to the tokens.
+func (s authService) ConfirmMFA(ctx *fiber.Ctx, data dto.MFAConfirmRequest) (dto.TokenResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TokenResponse
+	if err := data.Validate(); err != nil {
+		return resp, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	challenge, email, err := s.getChallenge(ctx, tx, data.MFAToken, domain.MFAPurposeEnrol)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	codes, err := s.twoFactor.Complete(ctx, tx, challenge.UserID, data.Code)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrInvalidMFACode) {
+			s.lockout.RecordFailure(ctx, email)
+		}
+		return resp, err
+	}
+
+	err = s.mfaRepo.MarkUsed(ctx.Context(), tx, challenge.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error marking challenge used", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resp, err = s.createSession(ctx, tx, challenge.UserID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+	resp.RecoveryCodes = codes
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return dto.TokenResponse{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	s.lockout.RecordSuccess(ctx, email)
+	return resp, nil
+}
+
+func (s authService) Refresh(ctx *fiber.Ctx, data dto.RefreshRequest) (dto.TokenResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TokenResponse
+	if err := data.Validate(); err != nil {
+		return resp, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	session, refreshToken, err := s.sessionRepo.GetByRefreshTokenForUpdate(ctx.Context(), tx, helpers.HashToken(data.RefreshToken))
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrInvalidRefreshToken) {
+			return resp, helpers.NewResponseError(helpers.ErrInvalidRefreshToken, fiber.StatusUnauthorized)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting refresh token", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if !session.IsActive() {
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInvalidRefreshToken, fiber.StatusUnauthorized)
+	}
+
+	// a rotated token presented again means it leaked, so end the session for
+	// both the legitimate client and whoever replayed it.
+	if refreshToken.UsedAt.Valid {
+		s.logger.WarnContext(ctx.Context(), "refresh token reuse detected", "session_id", session.ID, "user_id", session.UserID, "request_id", requestID)
+		err = s.sessionRepo.Revoke(ctx.Context(), tx, session.ID, session.UserID)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error revoking session", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+		err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+			ActorType:  domain.ActorUser,
+			ActorID:    session.UserID,
+			Action:     domain.AuditSessionRevoked,
+			TargetType: domain.TargetSession,
+			TargetID:   session.ID,
+		})
+		if err != nil {
+			tx.Rollback(ctx.Context())
+			return resp, err
+		}
+		if err = tx.Commit(ctx.Context()); err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		}
+		return resp, helpers.NewResponseError(helpers.ErrInvalidRefreshToken, fiber.StatusUnauthorized)
+	}
+
+	err = s.sessionRepo.MarkRefreshTokenUsed(ctx.Context(), tx, refreshToken.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error marking refresh token used", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.sessionRepo.Touch(ctx.Context(), tx, session.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error updating session", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resp, err = s.issueTokens(ctx, tx, session.UserID, session.ID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		ActorType:  domain.ActorUser,
+		ActorID:    session.UserID,
+		Action:     domain.AuditSessionRefreshed,
+		TargetType: domain.TargetSession,
+		TargetID:   session.ID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return dto.TokenResponse{}, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return dto.TokenResponse{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return resp, nil
+}
+
+func (s authService) Logout(ctx *fiber.Ctx, userID, sessionID uint) error {
+	return s.RevokeSession(ctx, userID, sessionID)
+}
+
+func (s authService) GetSessions(ctx *fiber.Ctx, userID, currentSessionID uint) ([]dto.SessionResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var sessions []dto.SessionResponse
+
+	data, err := s.sessionRepo.GetActiveByUserID(ctx.Context(), userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting sessions", "error", err, "request_id", requestID)
+		return sessions, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	for _, session := range data {
+		sessions = append(sessions, dto.SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			Current:    session.ID == currentSessionID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+		})
+	}
+
+	return sessions, nil
+}
+
+func (s authService) RevokeSession(ctx *fiber.Ctx, userID, sessionID uint) error {
+	requestID := ctx.Context().Value("requestid")
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.sessionRepo.Revoke(ctx.Context(), tx, sessionID, userID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrSessionNotFound) {
+			return helpers.NewResponseError(helpers.ErrSessionNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error revoking session", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditSessionRevoked,
+		TargetType: domain.TargetSession,
+		TargetID:   sessionID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// ForgotPassword emails a reset token to the user owning data.Email. It
+// reports success for unknown emails too, so it cannot be used to probe
+// which addresses are registered.
+func (s authService) ForgotPassword(ctx *fiber.Ctx, data dto.ForgotPasswordRequest) error {
+	requestID := ctx.Context().Value("requestid")
+	if err := data.Validate(); err != nil {
+		return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx.Context(), data.Email)
+	if err != nil {
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return nil
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting user by email", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resetToken, err := helpers.GenerateToken()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating reset token", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+	expiresAt := time.Now().Add(s.conf.Account.PasswordResetTTL)
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// only the most recently requested token stays usable
+	err = s.resetRepo.InvalidateByUserID(ctx.Context(), tx, user.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error invalidating reset tokens", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.resetRepo.Insert(ctx.Context(), tx, domain.OneTimeToken{
+		UserID:    user.ID,
+		TokenHash: helpers.HashToken(resetToken),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting reset token", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// anyone knowing the email may ask, so the request stays anonymous
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditPasswordResetRequested,
+		TargetType: domain.TargetUser,
+		TargetID:   user.ID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// the email is sent in the background, so the answer does not take longer
+	// for a registered email than for an unknown one. The request context is
+	// reused once the handler returns and can not be passed on.
+	msg := mail.Message{
+		To:      user.Email.String,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\r\n\r\nUse the following token to reset your password:\r\n\r\n%s\r\n\r\nThe token expires at %s. If you did not request a password reset, you can ignore this email.\r\n", user.Name.String, resetToken, expiresAt.Format(time.RFC1123)),
+	}
+	go func() {
+		if err := s.mailer.Send(context.Background(), msg); err != nil {
+			s.logger.Error("error sending reset email", "error", err, "request_id", requestID)
+		}
+	}()
+
+	return nil
+}
+
+func (s authService) ResetPassword(ctx *fiber.Ctx, data dto.ResetPasswordRequest) error {
+	requestID := ctx.Context().Value("requestid")
+	if err := data.Validate(); err != nil {
+		return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resetToken, err := s.resetRepo.GetForUpdate(ctx.Context(), tx, helpers.HashToken(data.Token))
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrInvalidResetToken) {
+			return helpers.NewResponseError(helpers.ErrInvalidResetToken, fiber.StatusBadRequest)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting reset token", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if !resetToken.IsValid() {
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInvalidResetToken, fiber.StatusBadRequest)
+	}
+
+	// lock current record
+	old, err := s.userRepo.GetForUpdate(ctx.Context(), tx, resetToken.UserID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return helpers.NewResponseError(helpers.ErrInvalidResetToken, fiber.StatusBadRequest)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting user for update", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if err := data.ValidatePassword(s.policy.Rule(old.Name.String, old.Email.String)); err != nil {
+		tx.Rollback(ctx.Context())
+		return passwordPolicyError(ctx, s.logger, err)
+	}
+
+	hashed, err := s.hasher.Hash(data.Password)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error hashing password", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	user := domain.User{
+		Version:  old.Version,
+		Password: sql.NullString{String: hashed, Valid: true},
+	}
+
+	// update user record
+	version, err := s.userRepo.Update(ctx.Context(), tx, old.ID, user)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error updating user", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// record change history
+	changes := helpers.UserChanges(old, user)
+	// the reset token proves the user made the change
+	err = s.historyRepo.Insert(ctx.Context(), tx, domain.UserHistory{
+		UserID:    old.ID,
+		Version:   version,
+		Changes:   changes,
+		ActorType: domain.ActorUser,
+		ActorID:   old.ID,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting user history", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// the token proves the request comes from the user
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		ActorType:  domain.ActorUser,
+		ActorID:    old.ID,
+		Action:     domain.AuditPasswordReset,
+		TargetType: domain.TargetUser,
+		TargetID:   old.ID,
+		Changes:    changes,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// a new password ends every existing session
+	err = s.sessionRepo.RevokeAllByUserID(ctx.Context(), tx, old.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error revoking sessions", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// consume the token along with any other outstanding one
+	err = s.resetRepo.InvalidateByUserID(ctx.Context(), tx, old.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error invalidating reset tokens", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// createSession starts a session for the user and issues its tokens. The
+// caller owns tx.
+func (s authService) createSession(ctx *fiber.Ctx, tx pgx.Tx, userID uint) (dto.TokenResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	// create session record
+	// postgres rejects invalid UTF-8, so the header is cleaned and cut
+	// between characters
+	userAgent := strings.ToValidUTF8(ctx.Get(fiber.HeaderUserAgent), "")
+	if len(userAgent) > 250 {
+		cut := 250
+		for !utf8.RuneStart(userAgent[cut]) {
+			cut--
+		}
+		userAgent = userAgent[:cut]
+	}
+	sessionID, err := s.sessionRepo.Insert(ctx.Context(), tx, domain.Session{
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        ctx.IP(),
+		ExpiresAt: time.Now().Add(s.conf.JWT.SessionTTL),
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting session", "error", err, "request_id", requestID)
+		return dto.TokenResponse{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		ActorType:  domain.ActorUser,
+		ActorID:    userID,
+		Action:     domain.AuditSessionCreated,
+		TargetType: domain.TargetSession,
+		TargetID:   sessionID,
+	})
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	return s.issueTokens(ctx, tx, userID, sessionID)
+}
+
+// createChallenge stores a challenge for the second step of a login and
+// returns it in place of the tokens. The caller owns tx.
+func (s authService) createChallenge(ctx *fiber.Ctx, tx pgx.Tx, userID uint, purpose string) (dto.TokenResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TokenResponse
+
+	mfaToken, err := helpers.GenerateToken()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating challenge token", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.mfaRepo.Insert(ctx.Context(), tx, domain.MFAChallenge{
+		OneTimeToken: domain.OneTimeToken{
+			UserID:    userID,
+			TokenHash: helpers.HashToken(mfaToken),
+			ExpiresAt: time.Now().Add(s.conf.TOTP.ChallengeTTL),
+		},
+		Purpose: purpose,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting challenge", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		ActorType:  domain.ActorUser,
+		ActorID:    userID,
+		Action:     domain.AuditSessionChallenged,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	resp.MFAToken = mfaToken
+	resp.MFARequired = purpose == domain.MFAPurposeVerify
+	resp.MFAEnrolmentRequired = purpose == domain.MFAPurposeEnrol
+
+	return resp, nil
+}
+
+// getChallenge locks a usable challenge for purpose and checks that its
+// account is not locked out. It returns the email the account's failed
+// attempts are counted under.
+func (s authService) getChallenge(ctx *fiber.Ctx, tx pgx.Tx, mfaToken, purpose string) (domain.MFAChallenge, string, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	challenge, err := s.mfaRepo.GetForUpdate(ctx.Context(), tx, helpers.HashToken(mfaToken))
+	if err != nil {
+		if errors.Is(err, helpers.ErrInvalidMFAToken) {
+			return challenge, "", helpers.NewResponseError(helpers.ErrInvalidMFAToken, fiber.StatusUnauthorized)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting challenge", "error", err, "request_id", requestID)
+		return challenge, "", helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if !challenge.IsValid() || challenge.Purpose != purpose {
+		return challenge, "", helpers.NewResponseError(helpers.ErrInvalidMFAToken, fiber.StatusUnauthorized)
+	}
+
+	user, err := s.userRepo.GetByID(ctx.Context(), challenge.UserID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting user by id", "error", err, "request_id", requestID)
+		return challenge, "", helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+	if user.ID == 0 {
+		return challenge, "", helpers.NewResponseError(helpers.ErrInvalidMFAToken, fiber.StatusUnauthorized)
+	}
+
+	if err := s.lockout.Check(ctx, user.Email.String); err != nil {
+		return challenge, "", err
+	}
+
+	return challenge, user.Email.String, nil
+}
+
+// issueTokens stores a new refresh token for the session and returns it
+// together with a fresh access token. The caller owns tx.
+func (s authService) issueTokens(ctx *fiber.Ctx, tx pgx.Tx, userID, sessionID uint) (dto.TokenResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TokenResponse
+
+	refreshToken, err := helpers.GenerateToken()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating refresh token", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.sessionRepo.InsertRefreshToken(ctx.Context(), tx, sessionID, helpers.HashToken(refreshToken))
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting refresh token", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	accessToken, expiresAt, err := s.tokens.Issue(userID, sessionID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error issuing access token", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resp.AccessToken = accessToken
+	resp.TokenType = "Bearer"
+	resp.ExpiresIn = int64(time.Until(expiresAt).Seconds())
+	resp.RefreshToken = refreshToken
+
+	return resp, nil
+}
@@ -0,0 +1,515 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"kazokku/internal/infrastructure/cardbrand"
+	"kazokku/internal/infrastructure/envelope"
+	"log/slog"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CreditCardService interface {
+	GetAll(ctx *fiber.Ctx, userID uint) ([]dto.CreditCardResponse, error)
+	Create(ctx *fiber.Ctx, data dto.CreditCardRequest) (uint, error)
+	UpdateByID(ctx *fiber.Ctx, data dto.CreditCardRequest) error
+	DeleteByID(ctx *fiber.Ctx, userID, cardID uint) error
+}
+
+type creditCardService struct {
+	db        *pgxpool.Pool
+	userRepo  repository.UserRepository
+	ccRepo    repository.CreditCardRepository
+	auditRepo repository.AuditRepository
+	vault     CardVault
+	brands    cardbrand.Table
+	logger    *slog.Logger
+}
+
+func NewCreditCardService(db *pgxpool.Pool, logger *slog.Logger, vault CardVault, brands cardbrand.Table, userRepo repository.UserRepository, ccRepo repository.CreditCardRepository, auditRepo repository.AuditRepository) CreditCardService {
+	return creditCardService{
+		db:        db,
+		userRepo:  userRepo,
+		ccRepo:    ccRepo,
+		auditRepo: auditRepo,
+		vault:     vault,
+		brands:    brands,
+		logger:    logger,
+	}
+}
+
+func (s creditCardService) GetAll(ctx *fiber.Ctx, userID uint) ([]dto.CreditCardResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var cards []dto.CreditCardResponse
+	if err := authorize(ctx, domain.ScopeCardsReadMasked); err != nil {
+		return cards, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx.Context(), userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting user by id", "error", err, "request_id", requestID)
+		return cards, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if user.IsEmpty() {
+		return cards, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+	}
+
+	data, err := s.ccRepo.GetByUserID(ctx.Context(), userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting credit cards", "error", err, "request_id", requestID)
+		return cards, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	_, cards = cardResponses(data)
+
+	return cards, nil
+}
+
+// Create adds a card to the user. Their first card becomes the default one.
+func (s creditCardService) Create(ctx *fiber.Ctx, data dto.CreditCardRequest) (uint, error) {
+	requestID := ctx.Context().Value("requestid")
+	if err := authorize(ctx, domain.ScopeCardsWrite); err != nil {
+		return 0, err
+	}
+
+	if err := data.ValidateCreate(s.brands); err != nil {
+		return 0, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// lock the user, which also serializes changes of the default card
+	user, err := s.lockUser(ctx, tx, data.UserID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, err
+	}
+
+	// create credit card record, its number and CVV go to the vault
+	cc, err := tokenizeCard(ctx, tx, s.logger, s.vault, helpers.CreditCardDTOtoDomain(data))
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, err
+	}
+
+	// the default flag is moved over once the card exists
+	isDefault := cc.IsDefault || user.CreditCard.ID == 0
+	cc.IsDefault = false
+	id, err := s.ccRepo.Insert(ctx.Context(), tx, cc)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting credit card", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if isDefault {
+		cc.IsDefault = true
+		err = s.ccRepo.SetDefault(ctx.Context(), tx, data.UserID, id)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error setting default credit card", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditCardCreated,
+		TargetType: domain.TargetCard,
+		TargetID:   id,
+		Changes:    helpers.CardChanges(domain.CreditCard{}, cc),
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return id, nil
+}
+
+// UpdateByID changes the provided fields of a card. Setting default moves
+// the flag from the user's current default card; it cannot be cleared.
+func (s creditCardService) UpdateByID(ctx *fiber.Ctx, data dto.CreditCardRequest) error {
+	requestID := ctx.Context().Value("requestid")
+	if err := authorize(ctx, domain.ScopeCardsWrite); err != nil {
+		return err
+	}
+
+	if err := data.ValidateUpdate(s.brands); err != nil {
+		return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if _, err := s.lockUser(ctx, tx, data.UserID); err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	old, err := s.lockCard(ctx, tx, data.UserID, data.CardID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	cc := helpers.CreditCardDTOtoDomain(data)
+	if cc.Type.Valid || cc.Number.Valid || cc.Name.Valid || cc.Expired.Valid {
+		cc, err = updateCard(ctx, tx, s.logger, s.vault, s.ccRepo, old, cc)
+		if err != nil {
+			tx.Rollback(ctx.Context())
+			return err
+		}
+	}
+
+	if cc.IsDefault && !old.IsDefault {
+		err = s.ccRepo.SetDefault(ctx.Context(), tx, data.UserID, old.ID)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error setting default credit card", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditCardUpdated,
+		TargetType: domain.TargetCard,
+		TargetID:   old.ID,
+		Changes:    helpers.CardChanges(old, cc),
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// DeleteByID removes a card and its number from the vault. When it was the
+// default card, the user's oldest remaining card takes over.
+func (s creditCardService) DeleteByID(ctx *fiber.Ctx, userID, cardID uint) error {
+	requestID := ctx.Context().Value("requestid")
+	if err := authorize(ctx, domain.ScopeCardsWrite); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if _, err := s.lockUser(ctx, tx, userID); err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	old, err := s.lockCard(ctx, tx, userID, cardID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	err = s.ccRepo.Delete(ctx.Context(), tx, old.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error deleting credit card", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if old.Token.Valid {
+		err = s.vault.Delete(ctx.Context(), tx, old.Token.String)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error deleting card from vault", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	if old.IsDefault {
+		err = s.ccRepo.PromoteDefault(ctx.Context(), tx, userID)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error promoting default credit card", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditCardDeleted,
+		TargetType: domain.TargetCard,
+		TargetID:   old.ID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// lockUser locks the user and returns it with its default card. The caller
+// owns tx.
+func (s creditCardService) lockUser(ctx *fiber.Ctx, tx pgx.Tx, userID uint) (domain.User, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	user, err := s.userRepo.GetForUpdate(ctx.Context(), tx, userID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return user, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting user for update", "error", err, "request_id", requestID)
+		return user, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return user, nil
+}
+
+// lockCard locks card cardID of the user. The caller owns tx.
+func (s creditCardService) lockCard(ctx *fiber.Ctx, tx pgx.Tx, userID, cardID uint) (domain.CreditCard, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	cc, err := s.ccRepo.GetForUpdate(ctx.Context(), tx, userID, cardID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrCardNotFound) {
+			return cc, helpers.NewResponseError(helpers.ErrCardNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting credit card for update", "error", err, "request_id", requestID)
+		return cc, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return cc, nil
+}
+
+// tokenizeCard hands the number and CVV of cc to the vault and returns cc
+// with the token and last four digits it is stored under. The type becomes
+// the brand of the number, whatever was submitted. The caller owns tx.
+func tokenizeCard(ctx *fiber.Ctx, tx pgx.Tx, logger *slog.Logger, vault CardVault, cc domain.CreditCard) (domain.CreditCard, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	token, brand, err := vault.Tokenize(ctx.Context(), tx, cc.Number.String, cc.CVV.String)
+	if err != nil {
+		if errors.Is(err, helpers.ErrInvalidCreditCard) {
+			return cc, helpers.NewResponseError(helpers.ErrInvalidCreditCard, fiber.StatusBadRequest)
+		}
+		logger.ErrorContext(ctx.Context(), "error storing card in vault", "error", err, "request_id", requestID)
+		return cc, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+	cc.Token = sql.NullString{String: token, Valid: true}
+	cc.Type = sql.NullString{String: brand, Valid: true}
+	cc.Last4 = sql.NullString{String: helpers.GetLast4Digits(cc.Number.String), Valid: true}
+
+	return cc, nil
+}
+
+// updateCard applies the provided fields of cc to the locked card old and
+// returns them as stored. A new number goes to the vault in place of the old
+// one. The caller owns tx.
+func updateCard(ctx *fiber.Ctx, tx pgx.Tx, logger *slog.Logger, vault CardVault, ccRepo repository.CreditCardRepository, old, cc domain.CreditCard) (domain.CreditCard, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	var err error
+	if cc.Number.Valid {
+		cc, err = tokenizeCard(ctx, tx, logger, vault, cc)
+		if err != nil {
+			return cc, err
+		}
+	}
+
+	// update credit card record
+	cc.ID = old.ID
+	err = ccRepo.Update(ctx.Context(), tx, cc)
+	if err != nil {
+		logger.ErrorContext(ctx.Context(), "error updating credit card", "error", err, "request_id", requestID)
+		return cc, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if cc.Token.Valid && old.Token.Valid {
+		err = vault.Delete(ctx.Context(), tx, old.Token.String)
+		if err != nil {
+			logger.ErrorContext(ctx.Context(), "error deleting card from vault", "error", err, "request_id", requestID)
+			return cc, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	return cc, nil
+}
+
+func cardResponse(cc domain.CreditCard) dto.CreditCardResponse {
+	return dto.CreditCardResponse{
+		ID:        cc.ID,
+		Type:      cc.Type.String,
+		Number:    cc.Last4.String,
+		Name:      cc.Name.String,
+		Expired:   cc.Expired.String,
+		Default:   cc.IsDefault,
+		CreatedAt: cc.CreatedAt.Time,
+		UpdatedAt: cc.UpdatedAt.Time,
+	}
+}
+
+// cardResponses returns the default card among cards, if any, and all of
+// them.
+func cardResponses(cards []domain.CreditCard) (*dto.CreditCardResponse, []dto.CreditCardResponse) {
+	var def *dto.CreditCardResponse
+	resp := make([]dto.CreditCardResponse, len(cards))
+	for i, cc := range cards {
+		resp[i] = cardResponse(cc)
+		if cc.IsDefault {
+			def = &resp[i]
+		}
+	}
+
+	return def, resp
+}
+
+const cardTokenizeBatch = 100
+
+// legacyCardSecret holds the parts of a card that were sealed together
+// before the vault existed.
+type legacyCardSecret struct {
+	Number  string `json:"number"`
+	Expired string `json:"expired"`
+	CVV     string `json:"cvv"`
+}
+
+// openLegacyCard decrypts the number and expiry of a card sealed before the
+// vault existed. Its CVV is dropped.
+func openLegacyCard(keys envelope.Keyring, cc domain.CreditCard) (domain.CreditCard, error) {
+	additionalData := []byte("credit_card:user:" + strconv.FormatUint(uint64(cc.UserID), 10))
+	plaintext, err := keys.Open(cc.Sealed, additionalData)
+	if err != nil {
+		return cc, err
+	}
+
+	var secret legacyCardSecret
+	if err := json.Unmarshal(plaintext, &secret); err != nil {
+		return cc, err
+	}
+	cc.Number = sql.NullString{String: secret.Number, Valid: true}
+	cc.Expired = sql.NullString{String: secret.Expired, Valid: true}
+
+	return cc, nil
+}
+
+// CardTokenizer moves the cards stored before the vault existed into it,
+// whether kept in plaintext or sealed with their CVV, leaving only a token,
+// the last four digits and the expiry behind.
+type CardTokenizer struct {
+	db     *pgxpool.Pool
+	ccRepo repository.CreditCardRepository
+	vault  CardVault
+	keys   envelope.Keyring
+	logger *slog.Logger
+}
+
+func NewCardTokenizer(db *pgxpool.Pool, logger *slog.Logger, keys envelope.Keyring, vault CardVault, ccRepo repository.CreditCardRepository) CardTokenizer {
+	return CardTokenizer{
+		db:     db,
+		ccRepo: ccRepo,
+		vault:  vault,
+		keys:   keys,
+		logger: logger,
+	}
+}
+
+// Run tokenizes cards until none are left or ctx is done.
+func (t CardTokenizer) Run(ctx context.Context) error {
+	var total int
+	for ctx.Err() == nil {
+		n, err := t.tokenizeBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+	}
+
+	if total > 0 {
+		t.logger.InfoContext(ctx, "credit cards moved to the vault", "count", total)
+	}
+
+	return ctx.Err()
+}
+
+func (t CardTokenizer) tokenizeBatch(ctx context.Context) (int, error) {
+	tx, err := t.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cards, err := t.ccRepo.GetUntokenizedForUpdate(ctx, tx, cardTokenizeBatch)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, err
+	}
+
+	for _, cc := range cards {
+		if !cc.Sealed.IsEmpty() {
+			cc, err = openLegacyCard(t.keys, cc)
+			if err != nil {
+				tx.Rollback(ctx)
+				return 0, err
+			}
+		}
+
+		token, err := t.vault.Import(ctx, tx, cc.Number.String)
+		if err != nil {
+			tx.Rollback(ctx)
+			return 0, err
+		}
+		cc.Token = sql.NullString{String: token, Valid: true}
+		cc.Last4 = sql.NullString{String: helpers.GetLast4Digits(cc.Number.String), Valid: true}
+
+		if err = t.ccRepo.SetToken(ctx, tx, cc.ID, cc); err != nil {
+			tx.Rollback(ctx)
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(cards), nil
+}
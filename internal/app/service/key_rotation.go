@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/infrastructure/envelope"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// KeyRotator moves the vault to the current master key by re-wrapping the
+// data keys of its entries. It works in small batches next to live traffic,
+// which can still open entries under either key meanwhile, and records its
+// progress so an interrupted rotation resumes where it stopped.
+type KeyRotator struct {
+	db           *pgxpool.Pool
+	vaultRepo    repository.VaultRepository
+	rotationRepo repository.KeyRotationRepository
+	keys         envelope.Keyring
+	batch        int
+	logger       *slog.Logger
+}
+
+func NewKeyRotator(db *pgxpool.Pool, logger *slog.Logger, keys envelope.Keyring, batch int, vaultRepo repository.VaultRepository, rotationRepo repository.KeyRotationRepository) KeyRotator {
+	return KeyRotator{
+		db:           db,
+		vaultRepo:    vaultRepo,
+		rotationRepo: rotationRepo,
+		keys:         keys,
+		batch:        batch,
+		logger:       logger,
+	}
+}
+
+// Run rotates the entries not yet under the current master key. It returns
+// once every entry has been handled, or with the progress saved when ctx is
+// done.
+func (r KeyRotator) Run(ctx context.Context) error {
+	keyID := r.keys.CurrentKeyID()
+	rotation, err := r.rotationRepo.Start(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if rotation.LastEntryID > 0 {
+		r.logger.InfoContext(ctx, "resuming key rotation", "key_id", keyID, "last_entry_id", rotation.LastEntryID, "rotated", rotation.Rotated)
+	}
+
+	lastEntryID := rotation.LastEntryID
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, last, err := r.rotateBatch(ctx, keyID, lastEntryID)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		lastEntryID = last
+		r.logger.InfoContext(ctx, "vault entries rotated", "key_id", keyID, "count", n, "last_entry_id", lastEntryID)
+	}
+
+	// entries sealed behind the cursor by an instance still on the old key
+	remaining, err := r.vaultRepo.CountSealedNotUnder(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		if err := r.rotationRepo.Restart(ctx, keyID); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d vault entries are still sealed under another key, run again once every instance uses key %q", remaining, keyID)
+	}
+
+	if err := r.rotationRepo.Complete(ctx, keyID); err != nil {
+		return err
+	}
+	r.logger.InfoContext(ctx, "key rotation completed", "key_id", keyID)
+
+	return nil
+}
+
+func (r KeyRotator) rotateBatch(ctx context.Context, keyID string, afterID uint) (int, uint, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, afterID, err
+	}
+
+	entries, err := r.vaultRepo.GetSealedForUpdate(ctx, tx, afterID, keyID, r.batch)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, afterID, err
+	}
+	if len(entries) == 0 {
+		tx.Rollback(ctx)
+		return 0, afterID, nil
+	}
+
+	for _, entry := range entries {
+		sealed, err := r.keys.Rewrap(entry.Sealed, vaultAdditionalData(entry.Token))
+		if err != nil {
+			tx.Rollback(ctx)
+			return 0, afterID, fmt.Errorf("vault entry %d: %w", entry.ID, err)
+		}
+
+		if err = r.vaultRepo.UpdateSealed(ctx, tx, entry.ID, sealed); err != nil {
+			tx.Rollback(ctx)
+			return 0, afterID, err
+		}
+	}
+
+	last := entries[len(entries)-1].ID
+	if err = r.rotationRepo.Advance(ctx, tx, keyID, last, len(entries)); err != nil {
+		tx.Rollback(ctx)
+		return 0, afterID, err
+	}
+
+	// commit transaction
+	if err = tx.Commit(ctx); err != nil {
+		return 0, afterID, err
+	}
+
+	return len(entries), last, nil
+}
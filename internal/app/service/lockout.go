@@ -0,0 +1,241 @@
+package service
+
+import (
+	"errors"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"kazokku/internal/utils"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LockoutService throttles password guessing. Failed logins are counted per
+// account and per client IP in Postgres so every replica sees the same
+// counters: repeated failures on an account delay its next attempt, and
+// reaching the threshold locks it for a while.
+type LockoutService interface {
+	Check(ctx *fiber.Ctx, email string) error
+	RecordFailure(ctx *fiber.Ctx, email string)
+	RecordSuccess(ctx *fiber.Ctx, email string)
+	Unlock(ctx *fiber.Ctx, userID uint) error
+}
+
+type lockoutService struct {
+	db          *pgxpool.Pool
+	attemptRepo repository.LoginAttemptRepository
+	userRepo    repository.UserRepository
+	auditRepo   repository.AuditRepository
+	conf        utils.Account
+	logger      *slog.Logger
+}
+
+func NewLockoutService(db *pgxpool.Pool, logger *slog.Logger, conf utils.Account, attemptRepo repository.LoginAttemptRepository, userRepo repository.UserRepository, auditRepo repository.AuditRepository) LockoutService {
+	return lockoutService{
+		db:          db,
+		attemptRepo: attemptRepo,
+		userRepo:    userRepo,
+		auditRepo:   auditRepo,
+		conf:        conf,
+		logger:      logger,
+	}
+}
+
+// Check rejects the attempt when the client IP or the account is locked,
+// or when the account must still wait out its delay.
+func (s lockoutService) Check(ctx *fiber.Ctx, email string) error {
+	requestID := ctx.Context().Value("requestid")
+
+	ip, err := s.attemptRepo.Get(ctx.Context(), domain.LoginAttemptIP, ctx.IP())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting login attempts", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+	if ip.IsLocked() {
+		setRetryAfter(ctx, ip.LockedUntil.Time)
+		return helpers.NewResponseError(helpers.ErrTooManyLoginAttempts, fiber.StatusTooManyRequests)
+	}
+
+	account, err := s.attemptRepo.Get(ctx.Context(), domain.LoginAttemptAccount, accountSubject(email))
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting login attempts", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+	if account.IsLocked() {
+		setRetryAfter(ctx, account.LockedUntil.Time)
+		return helpers.NewResponseError(helpers.ErrAccountLocked, fiber.StatusLocked)
+	}
+	if account.IsDelayed() {
+		setRetryAfter(ctx, account.DelayedUntil.Time)
+		return helpers.NewResponseError(helpers.ErrTooManyLoginAttempts, fiber.StatusTooManyRequests)
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed attempt against the account and the client
+// IP. Unknown emails are counted too, so responses do not reveal which
+// accounts exist.
+func (s lockoutService) RecordFailure(ctx *fiber.Ctx, email string) {
+	requestID := ctx.Context().Value("requestid")
+	subject := accountSubject(email)
+	now := time.Now()
+
+	failures, err := s.attemptRepo.RecordFailure(ctx.Context(), domain.LoginAttemptAccount, subject, s.conf.LoginFailureWindow)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error recording login failure", "error", err, "request_id", requestID)
+	} else if failures >= s.conf.LoginLockoutThreshold {
+		until := now.Add(s.conf.LoginLockoutDuration)
+		if err := s.attemptRepo.Lock(ctx.Context(), domain.LoginAttemptAccount, subject, until); err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error locking account", "error", err, "request_id", requestID)
+		} else {
+			s.logger.WarnContext(ctx.Context(), "account locked", "event", "account_locked", "email", subject, "ip", ctx.IP(), "failures", failures, "locked_until", until, "request_id", requestID)
+			s.auditAccountLock(ctx, subject, until)
+		}
+	} else if failures > 1 {
+		// double the wait with every failure after the first
+		delay := time.Duration(float64(s.conf.LoginDelayBase) * math.Pow(2, float64(failures-2)))
+		delay = min(delay, s.conf.LoginDelayMax)
+		if err := s.attemptRepo.Delay(ctx.Context(), domain.LoginAttemptAccount, subject, now.Add(delay)); err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error delaying account", "error", err, "request_id", requestID)
+		}
+	}
+
+	failures, err = s.attemptRepo.RecordFailure(ctx.Context(), domain.LoginAttemptIP, ctx.IP(), s.conf.LoginFailureWindow)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error recording login failure", "error", err, "request_id", requestID)
+	} else if failures >= s.conf.LoginIPLockoutThreshold {
+		until := now.Add(s.conf.LoginLockoutDuration)
+		if err := s.attemptRepo.Lock(ctx.Context(), domain.LoginAttemptIP, ctx.IP(), until); err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error locking ip", "error", err, "request_id", requestID)
+		} else {
+			s.logger.WarnContext(ctx.Context(), "ip locked", "event", "ip_locked", "ip", ctx.IP(), "failures", failures, "locked_until", until, "request_id", requestID)
+			// the locked IP is the one recorded with the event
+			s.auditLock(ctx, domain.AuditEvent{
+				Action:     domain.AuditIPLocked,
+				TargetType: domain.TargetIP,
+				Changes:    lockChanges(until),
+			})
+		}
+	}
+}
+
+// RecordSuccess clears the failures of the account. Failures of the client
+// IP are kept, since one correct password says nothing about the others.
+func (s lockoutService) RecordSuccess(ctx *fiber.Ctx, email string) {
+	requestID := ctx.Context().Value("requestid")
+	if err := s.attemptRepo.Reset(ctx.Context(), domain.LoginAttemptAccount, accountSubject(email)); err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error resetting login attempts", "error", err, "request_id", requestID)
+	}
+}
+
+func (s lockoutService) Unlock(ctx *fiber.Ctx, userID uint) error {
+	requestID := ctx.Context().Value("requestid")
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// lock current record
+	user, err := s.userRepo.GetForUpdate(ctx.Context(), tx, userID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting user for update", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.attemptRepo.Unlock(ctx.Context(), tx, domain.LoginAttemptAccount, accountSubject(user.Email.String))
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error resetting login attempts", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditUserUnlocked,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// auditAccountLock records the lock of the account behind email. Emails of
+// no account are locked too, but there is nothing to audit for them.
+func (s lockoutService) auditAccountLock(ctx *fiber.Ctx, email string, until time.Time) {
+	requestID := ctx.Context().Value("requestid")
+
+	user, err := s.userRepo.GetByEmail(ctx.Context(), email)
+	if err != nil {
+		if !errors.Is(err, helpers.ErrUserNotFound) {
+			s.logger.ErrorContext(ctx.Context(), "error getting user by email", "error", err, "request_id", requestID)
+		}
+		return
+	}
+
+	s.auditLock(ctx, domain.AuditEvent{
+		Action:     domain.AuditUserLocked,
+		TargetType: domain.TargetUser,
+		TargetID:   user.ID,
+		Changes:    lockChanges(until),
+	})
+}
+
+// auditLock records a lock the system imposed. Failing to record it does
+// not undo the lock.
+func (s lockoutService) auditLock(ctx *fiber.Ctx, event domain.AuditEvent) {
+	requestID := ctx.Context().Value("requestid")
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return
+	}
+
+	event.ActorType = domain.ActorSystem
+	if err := recordAudit(ctx, tx, s.logger, s.auditRepo, event); err != nil {
+		tx.Rollback(ctx.Context())
+		return
+	}
+
+	// commit transaction
+	if err := tx.Commit(ctx.Context()); err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+	}
+}
+
+func lockChanges(until time.Time) []domain.FieldChange {
+	lockedUntil := until.UTC().Format(time.RFC3339)
+	return []domain.FieldChange{{Field: "locked_until", New: &lockedUntil}}
+}
+
+func accountSubject(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func setRetryAfter(ctx *fiber.Ctx, until time.Time) {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(seconds, 1)))
+}
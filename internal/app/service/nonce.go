@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"kazokku/internal/app/repository"
+	"log/slog"
+	"time"
+)
+
+// NoncePurger deletes request nonces whose timestamps are no longer
+// accepted, so the replay table only holds what can still be replayed.
+type NoncePurger struct {
+	nonceRepo repository.NonceRepository
+	logger    *slog.Logger
+	interval  time.Duration
+}
+
+func NewNoncePurger(logger *slog.Logger, interval time.Duration, nonceRepo repository.NonceRepository) NoncePurger {
+	return NoncePurger{
+		nonceRepo: nonceRepo,
+		logger:    logger,
+		interval:  interval,
+	}
+}
+
+// Run purges expired nonces every interval until ctx is done.
+func (p NoncePurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := p.nonceRepo.DeleteExpired(ctx); err != nil {
+			p.logger.ErrorContext(ctx, "error deleting expired nonces", "error", err)
+		}
+	}
+}
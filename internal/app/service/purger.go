@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UserPurger permanently removes users that have been soft-deleted for longer
+// than the retention period, together with their credit card and its vault
+// entry, photo records and the photo files on disk.
+type UserPurger struct {
+	db        *pgxpool.Pool
+	userRepo  repository.UserRepository
+	ccRepo    repository.CreditCardRepository
+	photoRepo repository.PhotoRepository
+	auditRepo repository.AuditRepository
+	vault     CardVault
+	logger    *slog.Logger
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewUserPurger(db *pgxpool.Pool, logger *slog.Logger, retention, interval time.Duration, userRepo repository.UserRepository, ccRepo repository.CreditCardRepository, photoRepo repository.PhotoRepository, auditRepo repository.AuditRepository, vault CardVault) UserPurger {
+	return UserPurger{
+		db:        db,
+		userRepo:  userRepo,
+		ccRepo:    ccRepo,
+		photoRepo: photoRepo,
+		auditRepo: auditRepo,
+		vault:     vault,
+		logger:    logger,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run purges expired users once and then every interval until ctx is done.
+func (p UserPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p UserPurger) purge(ctx context.Context) {
+	before := time.Now().Add(-p.retention)
+	ids, err := p.userRepo.GetDeletedBefore(ctx, before)
+	if err != nil {
+		p.logger.ErrorContext(ctx, "error getting deleted users", "error", err)
+		return
+	}
+
+	for _, id := range ids {
+		err := p.purgeUser(ctx, id, before)
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			p.logger.ErrorContext(ctx, "error purging user", "error", err, "user_id", id)
+			continue
+		}
+		p.logger.InfoContext(ctx, "user purged", "user_id", id)
+	}
+}
+
+func (p UserPurger) purgeUser(ctx context.Context, userID uint, before time.Time) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = p.photoRepo.PurgeByUserID(ctx, tx, userID); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	tokens, err := p.ccRepo.PurgeByUserID(ctx, tx, userID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	for _, token := range tokens {
+		if err = p.vault.Delete(ctx, tx, token); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+	}
+
+	// the user may have been restored since it was listed, in which case
+	// nothing is deleted and the whole transaction is rolled back.
+	if err = p.userRepo.Purge(ctx, tx, userID, before); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	err = p.auditRepo.Insert(ctx, tx, domain.AuditEvent{
+		ActorType:  domain.ActorSystem,
+		Action:     domain.AuditUserPurged,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+	})
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return helpers.RemoveUserFiles(userID)
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"kazokku/internal/infrastructure/totp"
+	"kazokku/internal/utils"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TwoFactorService interface {
+	Enrol(ctx *fiber.Ctx, userID uint) (dto.TOTPEnrolmentResponse, error)
+	Confirm(ctx *fiber.Ctx, userID uint, data dto.TOTPConfirmRequest) (dto.RecoveryCodesResponse, error)
+	Complete(ctx *fiber.Ctx, tx pgx.Tx, userID uint, code string) ([]string, error)
+	Verify(ctx *fiber.Ctx, tx pgx.Tx, userID uint, data dto.MFAVerifyRequest) error
+	Reset(ctx *fiber.Ctx, userID uint) error
+}
+
+type twoFactorService struct {
+	db            *pgxpool.Pool
+	userRepo      repository.UserRepository
+	twoFactorRepo repository.TwoFactorRepository
+	sessionRepo   repository.SessionRepository
+	auditRepo     repository.AuditRepository
+	otp           totp.Manager
+	conf          utils.TOTP
+	logger        *slog.Logger
+}
+
+func NewTwoFactorService(db *pgxpool.Pool, logger *slog.Logger, conf utils.TOTP, otp totp.Manager, userRepo repository.UserRepository, twoFactorRepo repository.TwoFactorRepository, sessionRepo repository.SessionRepository, auditRepo repository.AuditRepository) TwoFactorService {
+	return twoFactorService{
+		db:            db,
+		userRepo:      userRepo,
+		twoFactorRepo: twoFactorRepo,
+		sessionRepo:   sessionRepo,
+		auditRepo:     auditRepo,
+		otp:           otp,
+		conf:          conf,
+		logger:        logger,
+	}
+}
+
+// Enrol starts an enrolment by storing a new, unconfirmed secret. The user
+// adds it to an authenticator app and proves so with Confirm.
+func (s twoFactorService) Enrol(ctx *fiber.Ctx, userID uint) (dto.TOTPEnrolmentResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.TOTPEnrolmentResponse
+
+	user, err := s.userRepo.GetByID(ctx.Context(), userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting user by id", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+	if user.ID == 0 {
+		return resp, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// lock current record
+	current, err := s.twoFactorRepo.GetForUpdate(ctx.Context(), tx, userID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return resp, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting two-factor state", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if current.IsEnabled() {
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrTOTPAlreadyEnabled, fiber.StatusConflict)
+	}
+
+	key, err := s.otp.Generate(user.Email.String)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating totp key", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	sealed, err := s.otp.Seal(userID, key.Secret)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error encrypting totp secret", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.twoFactorRepo.SetSecret(ctx.Context(), tx, userID, sealed)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error storing totp secret", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// enrolment during login runs before the user holds a token
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		ActorType:  domain.ActorUser,
+		ActorID:    userID,
+		Action:     domain.AuditTwoFactorEnrolled,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+		Changes:    []domain.FieldChange{{Field: "totp_secret"}},
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resp.Secret = key.Secret
+	resp.URI = key.URI
+	resp.QRCode = "data:image/png;base64," + base64.StdEncoding.EncodeToString(key.QRCode)
+
+	return resp, nil
+}
+
+func (s twoFactorService) Confirm(ctx *fiber.Ctx, userID uint, data dto.TOTPConfirmRequest) (dto.RecoveryCodesResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var resp dto.RecoveryCodesResponse
+	if err := data.Validate(); err != nil {
+		return resp, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	codes, err := s.Complete(ctx, tx, userID, data.Code)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return resp, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return resp, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	resp.RecoveryCodes = codes
+	return resp, nil
+}
+
+// Complete enables the pending secret of the user once code proves the
+// authenticator holds it, and returns a fresh set of recovery codes. Only
+// their hashes are stored, so this is the one time they can be shown. The
+// caller owns tx.
+func (s twoFactorService) Complete(ctx *fiber.Ctx, tx pgx.Tx, userID uint, code string) ([]string, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	// lock current record
+	current, err := s.twoFactorRepo.GetForUpdate(ctx.Context(), tx, userID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return nil, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting two-factor state", "error", err, "request_id", requestID)
+		return nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if current.IsEnabled() {
+		return nil, helpers.NewResponseError(helpers.ErrTOTPAlreadyEnabled, fiber.StatusConflict)
+	}
+	if !current.IsPending() {
+		return nil, helpers.NewResponseError(helpers.ErrTOTPNotPending, fiber.StatusBadRequest)
+	}
+
+	secret, err := s.otp.Open(userID, current.Secret)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error decrypting totp secret", "error", err, "request_id", requestID)
+		return nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	step, ok := s.otp.Validate(secret, code, current.LastStep)
+	if !ok {
+		return nil, helpers.NewResponseError(helpers.ErrInvalidMFACode, fiber.StatusBadRequest)
+	}
+
+	err = s.twoFactorRepo.Enable(ctx.Context(), tx, userID, step)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error enabling totp", "error", err, "request_id", requestID)
+		return nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(s.conf.RecoveryCodes)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating recovery codes", "error", err, "request_id", requestID)
+		return nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, helpers.HashToken(totp.NormalizeRecoveryCode(code)))
+	}
+
+	err = s.twoFactorRepo.ReplaceRecoveryCodes(ctx.Context(), tx, userID, hashes)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error storing recovery codes", "error", err, "request_id", requestID)
+		return nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		ActorType:  domain.ActorUser,
+		ActorID:    userID,
+		Action:     domain.AuditTwoFactorEnabled,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+		Changes:    []domain.FieldChange{{Field: "totp_enabled"}, {Field: "recovery_codes"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks the second factor of a login, either a current code or an
+// unused recovery code, and consumes it. The caller owns tx.
+func (s twoFactorService) Verify(ctx *fiber.Ctx, tx pgx.Tx, userID uint, data dto.MFAVerifyRequest) error {
+	requestID := ctx.Context().Value("requestid")
+
+	// lock current record
+	current, err := s.twoFactorRepo.GetForUpdate(ctx.Context(), tx, userID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return helpers.NewResponseError(helpers.ErrInvalidMFAToken, fiber.StatusUnauthorized)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting two-factor state", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if !current.IsEnabled() {
+		return helpers.NewResponseError(helpers.ErrInvalidMFAToken, fiber.StatusUnauthorized)
+	}
+
+	if data.RecoveryCode != "" {
+		err = s.twoFactorRepo.UseRecoveryCode(ctx.Context(), tx, userID, helpers.HashToken(totp.NormalizeRecoveryCode(data.RecoveryCode)))
+		if err != nil {
+			if errors.Is(err, helpers.ErrInvalidMFACode) {
+				return helpers.NewResponseError(helpers.ErrInvalidMFACode, fiber.StatusUnauthorized)
+			}
+			s.logger.ErrorContext(ctx.Context(), "error using recovery code", "error", err, "request_id", requestID)
+			return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+		return nil
+	}
+
+	secret, err := s.otp.Open(userID, current.Secret)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error decrypting totp secret", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	step, ok := s.otp.Validate(secret, data.Code, current.LastStep)
+	if !ok {
+		return helpers.NewResponseError(helpers.ErrInvalidMFACode, fiber.StatusUnauthorized)
+	}
+
+	err = s.twoFactorRepo.UpdateLastStep(ctx.Context(), tx, userID, step)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error updating totp step", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// Reset turns two-factor authentication off for a user who lost their
+// device and recovery codes, and ends their sessions. Cardholders are asked
+// to enrol again on their next login.
+func (s twoFactorService) Reset(ctx *fiber.Ctx, userID uint) error {
+	requestID := ctx.Context().Value("requestid")
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.twoFactorRepo.Reset(ctx.Context(), tx, userID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error resetting two-factor authentication", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.sessionRepo.RevokeAllByUserID(ctx.Context(), tx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error revoking sessions", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditTwoFactorReset,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+		Changes:    []domain.FieldChange{{Field: "totp_enabled"}, {Field: "recovery_codes"}},
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
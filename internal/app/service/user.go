@@ -1,15 +1,25 @@
 package service
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"kazokku/internal/app/delivery/dto"
 	"kazokku/internal/app/repository"
 	"kazokku/internal/domain"
 	"kazokku/internal/helpers"
+	"kazokku/internal/infrastructure/cardbrand"
+	"kazokku/internal/infrastructure/mail"
+	"kazokku/internal/infrastructure/password"
+	"kazokku/internal/utils"
 	"log/slog"
 	"path/filepath"
+	"strings"
+	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -18,34 +28,67 @@ type UserService interface {
 	Create(ctx *fiber.Ctx, data dto.UserRequest) (uint, error)
 	GetAll(ctx *fiber.Ctx, query dto.UserQuery) ([]dto.UserResponse, error)
 	GetByID(ctx *fiber.Ctx, userID uint) (dto.UserResponse, error)
-	UpdateByID(ctx *fiber.Ctx, data dto.UserRequest) error
+	UpdateByID(ctx *fiber.Ctx, data dto.UserRequest) (uint, error)
+	PatchByID(ctx *fiber.Ctx, data dto.UserPatchRequest) (uint, error)
+	DeleteByID(ctx *fiber.Ctx, userID uint) error
+	RestoreByID(ctx *fiber.Ctx, userID uint) error
+	GetHistory(ctx *fiber.Ctx, userID uint, query dto.HistoryQuery) ([]dto.HistoryResponse, error)
+	ConfirmEmail(ctx *fiber.Ctx, data dto.ConfirmEmailRequest) error
 }
 
 type userService struct {
-	db        *pgxpool.Pool
-	userRepo  repository.UserRepository
-	ccRepo    repository.CreditCardRepository
-	photoRepo repository.PhotoRepository
-	logger    *slog.Logger
+	db          *pgxpool.Pool
+	userRepo    repository.UserRepository
+	ccRepo      repository.CreditCardRepository
+	photoRepo   repository.PhotoRepository
+	historyRepo repository.HistoryRepository
+	sessionRepo repository.SessionRepository
+	verifyRepo  repository.EmailVerificationRepository
+	auditRepo   repository.AuditRepository
+	mailer      mail.Mailer
+	hasher      password.Hasher
+	policy      password.Policy
+	vault       CardVault
+	brands      cardbrand.Table
+	conf        utils.Config
+	logger      *slog.Logger
 }
 
-func NewUserService(db *pgxpool.Pool, logger *slog.Logger, userRepo repository.UserRepository, ccRepo repository.CreditCardRepository, photoRepo repository.PhotoRepository) UserService {
+func NewUserService(db *pgxpool.Pool, logger *slog.Logger, conf utils.Config, mailer mail.Mailer, hasher password.Hasher, policy password.Policy, vault CardVault, brands cardbrand.Table, userRepo repository.UserRepository, ccRepo repository.CreditCardRepository, photoRepo repository.PhotoRepository, historyRepo repository.HistoryRepository, sessionRepo repository.SessionRepository, verifyRepo repository.EmailVerificationRepository, auditRepo repository.AuditRepository) UserService {
 	return userService{
-		db:        db,
-		userRepo:  userRepo,
-		ccRepo:    ccRepo,
-		photoRepo: photoRepo,
-		logger:    logger,
+		db:          db,
+		userRepo:    userRepo,
+		ccRepo:      ccRepo,
+		photoRepo:   photoRepo,
+		historyRepo: historyRepo,
+		sessionRepo: sessionRepo,
+		verifyRepo:  verifyRepo,
+		auditRepo:   auditRepo,
+		mailer:      mailer,
+		hasher:      hasher,
+		policy:      policy,
+		vault:       vault,
+		brands:      brands,
+		conf:        conf,
+		logger:      logger,
 	}
 }
 
 func (s userService) Create(ctx *fiber.Ctx, data dto.UserRequest) (uint, error) {
 	requestID := ctx.Context().Value("requestid")
+	if err := authorize(ctx, domain.ScopeUsersRegister); err != nil {
+		return 0, err
+	}
+
 	if err := data.ValidateRegister(); err != nil {
 		return 0, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
 	}
 
-	if err := data.ValidateCreditCardRegister(); err != nil {
+	if err := data.ValidatePassword(s.policy.Rule(data.Name, data.Email)); err != nil {
+		return 0, passwordPolicyError(ctx, s.logger, err)
+	}
+
+	if err := data.ValidateCreditCardRegister(s.brands); err != nil {
 		return 0, helpers.NewResponseError(helpers.ErrInvalidCreditCard, fiber.StatusBadRequest)
 	}
 
@@ -59,7 +102,7 @@ func (s userService) Create(ctx *fiber.Ctx, data dto.UserRequest) (uint, error)
 		return 0, helpers.NewResponseError(errors.New("Please provide photos fields."), fiber.StatusBadRequest)
 	}
 
-	data.Password, err = helpers.HashPassword(data.Password)
+	data.Password, err = s.hasher.Hash(data.Password)
 	if err != nil {
 		s.logger.ErrorContext(ctx.Context(), "error hashing password", "error", err, "request_id", requestID)
 		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
@@ -72,7 +115,8 @@ func (s userService) Create(ctx *fiber.Ctx, data dto.UserRequest) (uint, error)
 	}
 
 	// create user record
-	id, err := s.userRepo.Insert(ctx.Context(), tx, helpers.UserRegisterDTOtoUserDomain(data))
+	user := helpers.UserRegisterDTOtoUserDomain(data)
+	id, err := s.userRepo.Insert(ctx.Context(), tx, user)
 	if err != nil {
 		s.logger.ErrorContext(ctx.Context(), "error inserting user", "error", err, "request_id", requestID)
 		tx.Rollback(ctx.Context())
@@ -83,14 +127,28 @@ func (s userService) Create(ctx *fiber.Ctx, data dto.UserRequest) (uint, error)
 		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
-	// create credit card record
-	err = s.ccRepo.Insert(ctx.Context(), tx, helpers.UserRegisterDTOtoCCDomain(data, id))
+	// create the first credit card record, its number and CVV go to the vault
+	user.CreditCard, err = tokenizeCard(ctx, tx, s.logger, s.vault, helpers.UserRegisterDTOtoCCDomain(data, id))
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, err
+	}
+	user.CreditCard.IsDefault = true
+
+	_, err = s.ccRepo.Insert(ctx.Context(), tx, user.CreditCard)
 	if err != nil {
 		s.logger.ErrorContext(ctx.Context(), "error inserting credit card", "error", err, "request_id", requestID)
 		tx.Rollback(ctx.Context())
 		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
+	// create email verification token
+	msg, err := s.createVerification(ctx, tx, id, data.Name, data.Email)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, err
+	}
+
 	// save photos
 	var photos []domain.Photo
 
@@ -119,6 +177,17 @@ func (s userService) Create(ctx *fiber.Ctx, data dto.UserRequest) (uint, error)
 		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditUserCreated,
+		TargetType: domain.TargetUser,
+		TargetID:   id,
+		Changes:    helpers.UserChanges(domain.User{}, user),
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, err
+	}
+
 	// commit transaction
 	err = tx.Commit(ctx.Context())
 	if err != nil {
@@ -126,12 +195,18 @@ func (s userService) Create(ctx *fiber.Ctx, data dto.UserRequest) (uint, error)
 		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
+	s.sendMails(ctx, msg)
+
 	return id, nil
 }
 
 func (s userService) GetAll(ctx *fiber.Ctx, query dto.UserQuery) ([]dto.UserResponse, error) {
 	requestID := ctx.Context().Value("requestid")
 	var users []dto.UserResponse
+	if err := authorize(ctx, domain.ScopeUsersRead); err != nil {
+		return users, err
+	}
+
 	if err := query.Validate(); err != nil {
 		return users, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
 	}
@@ -154,25 +229,37 @@ func (s userService) GetAll(ctx *fiber.Ctx, query dto.UserQuery) ([]dto.UserResp
 		return users, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
+	principal, _ := ctx.Locals("principal").(domain.Principal)
+
+	var cards map[uint][]domain.CreditCard
+	if principal.HasScope(domain.ScopeCardsReadMasked) && len(data) > 0 {
+		ids := make([]uint, len(data))
+		for i, user := range data {
+			ids[i] = user.ID
+		}
+		cards, err = s.ccRepo.GetByUserIDs(ctx.Context(), ids)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error getting credit cards", "error", err, "request_id", requestID)
+			return users, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
 	for _, user := range data {
-		var photos []string
-		for _, photo := range user.Photos {
-			photos = append(photos, filepath.ToSlash(filepath.Join("/photos", photo.Filepath)))
-		}
-
-		users = append(users, dto.UserResponse{
-			ID:      user.ID,
-			Name:    user.Name.String,
-			Email:   user.Email.String,
-			Address: user.Address.String,
-			Photos:  photos,
-			CreditCard: dto.CreditCardResponse{
-				Type:    user.CreditCard.Type.String,
-				Number:  helpers.GetLast4Digits(user.CreditCard.Number.String),
-				Name:    user.CreditCard.Name.String,
-				Expired: user.CreditCard.Expired.String,
-			},
-		})
+		resp := dto.UserResponse{
+			ID:              user.ID,
+			Name:            user.Name.String,
+			Email:           user.Email.String,
+			Address:         user.Address.String,
+			Photos:          photoResponses(user.Photos),
+			EmailVerifiedAt: nullTimeToPtr(user.EmailVerifiedAt),
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+		}
+		if principal.HasScope(domain.ScopeCardsReadMasked) {
+			resp.CreditCard, resp.CreditCards = cardResponses(cards[user.ID])
+		}
+
+		users = append(users, resp)
 	}
 
 	return users, nil
@@ -182,6 +269,10 @@ func (s userService) GetByID(ctx *fiber.Ctx, userID uint) (dto.UserResponse, err
 	requestID := ctx.Context().Value("requestid")
 	var user dto.UserResponse
 
+	if err := authorize(ctx, domain.ScopeUsersRead); err != nil {
+		return user, err
+	}
+
 	data, err := s.userRepo.GetByID(ctx.Context(), userID)
 	if err != nil {
 		s.logger.ErrorContext(ctx.Context(), "error getting user by id", "error", err, "request_id", requestID)
@@ -193,75 +284,98 @@ func (s userService) GetByID(ctx *fiber.Ctx, userID uint) (dto.UserResponse, err
 	}
 
 	user.ID = data.ID
+	user.Version = data.Version
 	user.Name = data.Name.String
 	user.Email = data.Email.String
 	user.Address = data.Address.String
-	user.Photos = make([]string, len(data.Photos))
-	user.CreditCard = dto.CreditCardResponse{
-		Type:    data.CreditCard.Type.String,
-		Number:  helpers.GetLast4Digits(data.CreditCard.Number.String),
-		Name:    data.CreditCard.Name.String,
-		Expired: data.CreditCard.Expired.String,
-	}
-
-	for i, photo := range data.Photos {
-		user.Photos[i] = filepath.ToSlash(filepath.Join("/photos", photo.Filepath))
+	user.Photos = photoResponses(data.Photos)
+	if principal, _ := ctx.Locals("principal").(domain.Principal); principal.HasScope(domain.ScopeCardsReadMasked) {
+		cards, err := s.ccRepo.GetByUserID(ctx.Context(), data.ID)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error getting credit cards", "error", err, "request_id", requestID)
+			return dto.UserResponse{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+		user.CreditCard, user.CreditCards = cardResponses(cards)
 	}
+	user.EmailVerifiedAt = nullTimeToPtr(data.EmailVerifiedAt)
+	user.CreatedAt = data.CreatedAt
+	user.UpdatedAt = data.UpdatedAt
 
 	return user, nil
 }
 
-func (s userService) UpdateByID(ctx *fiber.Ctx, data dto.UserRequest) error {
+func (s userService) UpdateByID(ctx *fiber.Ctx, data dto.UserRequest) (uint, error) {
 	requestID := ctx.Context().Value("requestid")
+	if err := authorize(ctx, domain.ScopeUsersWrite); err != nil {
+		return 0, err
+	}
+
 	if err := data.ValidateUpdate(); err != nil {
-		return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+		return 0, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
 	}
 
-	if err := data.ValidateCreditCardUpdate(); err != nil {
-		return helpers.NewResponseError(helpers.ErrInvalidCreditCard, fiber.StatusBadRequest)
+	if err := data.ValidateCreditCardUpdate(s.brands); err != nil {
+		return 0, helpers.NewResponseError(helpers.ErrInvalidCreditCard, fiber.StatusBadRequest)
 	}
 
 	files, err := ctx.MultipartForm()
 	if err != nil {
 		s.logger.ErrorContext(ctx.Context(), "error parsing multipart form", "error", err, "request_id", requestID)
-		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
-	}
-
-	if data.Password != "" {
-		data.Password, err = helpers.HashPassword(data.Password)
-		if err != nil {
-			s.logger.ErrorContext(ctx.Context(), "error hashing password", "error", err, "request_id", requestID)
-			return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
-		}
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
 	tx, err := s.db.Begin(ctx.Context())
 	if err != nil {
 		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
-		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
-	// update user record
-	err = s.userRepo.Update(ctx.Context(), tx, data.UserID, helpers.UserUpdateDTOtoUserDomain(data))
+	// lock current record
+	old, err := s.userRepo.GetForUpdate(ctx.Context(), tx, data.UserID)
 	if err != nil {
 		tx.Rollback(ctx.Context())
 		if errors.Is(err, helpers.ErrUserNotFound) {
-			return helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+			return 0, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
 		}
-		s.logger.ErrorContext(ctx.Context(), "error updating user", "error", err, "request_id", requestID)
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return helpers.NewResponseError(helpers.ErrEmailUsed, fiber.StatusConflict)
+		s.logger.ErrorContext(ctx.Context(), "error getting user for update", "error", err, "request_id", requestID)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if data.Version != 0 && data.Version != old.Version {
+		tx.Rollback(ctx.Context())
+		return 0, helpers.NewResponseError(helpers.ErrPreconditionFailed, fiber.StatusPreconditionFailed)
+	}
+
+	if data.Password != "" {
+		// check against the name and email the user will have after the update
+		name, email := data.Name, data.Email
+		if name == "" {
+			name = old.Name.String
+		}
+		if email == "" {
+			email = old.Email.String
+		}
+		if err := data.ValidatePassword(s.policy.Rule(name, email)); err != nil {
+			tx.Rollback(ctx.Context())
+			return 0, passwordPolicyError(ctx, s.logger, err)
+		}
+
+		data.Password, err = s.hasher.Hash(data.Password)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error hashing password", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 		}
-		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 	}
 
-	// update credit card record
-	err = s.ccRepo.Update(ctx.Context(), tx, helpers.UserUpdateDTOtoCCDomain(data, data.UserID))
+	user := helpers.UserUpdateDTOtoUserDomain(data)
+	user.Version = old.Version
+	user.CreditCard = helpers.UserUpdateDTOtoCCDomain(data, data.UserID)
+
+	version, msgs, err := s.update(ctx, tx, old, user)
 	if err != nil {
-		s.logger.ErrorContext(ctx.Context(), "error updating credit card", "error", err, "request_id", requestID)
 		tx.Rollback(ctx.Context())
-		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		return 0, err
 	}
 
 	// save photos
@@ -276,7 +390,7 @@ func (s userService) UpdateByID(ctx *fiber.Ctx, data dto.UserRequest) error {
 			if err != nil {
 				s.logger.ErrorContext(ctx.Context(), "error saving file", "error", err, "request_id", requestID)
 				tx.Rollback(ctx.Context())
-				return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+				return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 			}
 			photos = append(photos, domain.Photo{
 				UserID:   data.UserID,
@@ -289,10 +403,404 @@ func (s userService) UpdateByID(ctx *fiber.Ctx, data dto.UserRequest) error {
 		if err != nil {
 			s.logger.ErrorContext(ctx.Context(), "error inserting photos", "error", err, "request_id", requestID)
 			tx.Rollback(ctx.Context())
+			return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	s.sendMails(ctx, msgs...)
+
+	return version, nil
+}
+
+func (s userService) PatchByID(ctx *fiber.Ctx, data dto.UserPatchRequest) (uint, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	if err := authorize(ctx, domain.ScopeUsersWrite); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// lock current record
+	old, err := s.userRepo.GetForUpdate(ctx.Context(), tx, data.UserID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return 0, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting user for update", "error", err, "request_id", requestID)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if data.Version != 0 && data.Version != old.Version {
+		tx.Rollback(ctx.Context())
+		return 0, helpers.NewResponseError(helpers.ErrPreconditionFailed, fiber.StatusPreconditionFailed)
+	}
+
+	// apply patch to the current document
+	doc := helpers.UserDomainToPatchDocument(old)
+	patched, err := helpers.ApplyUserPatch(doc, data.ContentType, data.Patch)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, helpers.NewResponseError(helpers.ErrInvalidPatch, fiber.StatusBadRequest)
+	}
+	patched.UserID = data.UserID
+
+	if err := patched.ValidatePatch(old.CreditCard.ID != 0); err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	user := helpers.UserPatchDTOtoUserDomain(patched, doc)
+	changed := helpers.UserDomainToChangedDTO(user)
+	if err := changed.ValidateUpdate(); err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	if err := changed.ValidateCreditCardUpdate(s.brands); err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, helpers.NewResponseError(helpers.ErrInvalidCreditCard, fiber.StatusBadRequest)
+	}
+
+	if user.Password.Valid {
+		// the password is checked against the name and email it ends up with
+		name, email := patched.Name, patched.Email
+		if name == "" {
+			name = old.Name.String
+		}
+		if email == "" {
+			email = old.Email.String
+		}
+		if err := patched.ValidatePassword(s.policy.Rule(name, email)); err != nil {
+			tx.Rollback(ctx.Context())
+			return 0, passwordPolicyError(ctx, s.logger, err)
+		}
+
+		user.Password.String, err = s.hasher.Hash(user.Password.String)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error hashing password", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
+			return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+	user.Version = old.Version
+
+	version, msgs, err := s.update(ctx, tx, old, user)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return 0, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return 0, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	s.sendMails(ctx, msgs...)
+
+	return version, nil
+}
+
+func (s userService) DeleteByID(ctx *fiber.Ctx, userID uint) error {
+	requestID := ctx.Context().Value("requestid")
+
+	if err := authorize(ctx, domain.ScopeUsersDelete); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// soft delete user record
+	err = s.userRepo.Delete(ctx.Context(), tx, userID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error deleting user", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// deactivate credit card record
+	err = s.ccRepo.DeleteByUserID(ctx.Context(), tx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error deleting credit card", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// deactivate photo records
+	err = s.photoRepo.DeleteByUserID(ctx.Context(), tx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error deleting photos", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// a deleted user is signed out everywhere
+	err = s.sessionRepo.RevokeAllByUserID(ctx.Context(), tx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error revoking sessions", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditUserDeleted,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func (s userService) RestoreByID(ctx *fiber.Ctx, userID uint) error {
+	requestID := ctx.Context().Value("requestid")
+
+	if err := authorize(ctx, domain.ScopeUsersDelete); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// restore user record
+	err = s.userRepo.Restore(ctx.Context(), tx, userID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error restoring user", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// reactivate credit card record
+	err = s.ccRepo.RestoreByUserID(ctx.Context(), tx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error restoring credit card", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// reactivate photo records
+	err = s.photoRepo.RestoreByUserID(ctx.Context(), tx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error restoring photos", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditUserRestored,
+		TargetType: domain.TargetUser,
+		TargetID:   userID,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error commiting transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func (s userService) GetHistory(ctx *fiber.Ctx, userID uint, query dto.HistoryQuery) ([]dto.HistoryResponse, error) {
+	requestID := ctx.Context().Value("requestid")
+	var history []dto.HistoryResponse
+	if err := authorize(ctx, domain.ScopeUsersRead); err != nil {
+		return history, err
+	}
+
+	if err := query.Validate(); err != nil {
+		return history, helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = 30
+	}
+
+	user, err := s.userRepo.GetByID(ctx.Context(), userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting user by id", "error", err, "request_id", requestID)
+		return history, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if user.IsEmpty() {
+		return history, helpers.NewResponseError(helpers.ErrUserNotFound, fiber.StatusNotFound)
+	}
+
+	data, err := s.historyRepo.GetByUserID(ctx.Context(), userID, query)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error getting user history", "error", err, "request_id", requestID)
+		return history, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	principal, _ := ctx.Locals("principal").(domain.Principal)
+	for _, entry := range data {
+		changes := make([]dto.FieldChangeResponse, 0, len(entry.Changes))
+		for _, change := range entry.Changes {
+			// card changes are only shown to callers allowed to see cards
+			if strings.HasPrefix(change.Field, "creditcard_") && !principal.HasScope(domain.ScopeCardsReadMasked) {
+				continue
+			}
+			changes = append(changes, dto.FieldChangeResponse{
+				Field: change.Field,
+				Old:   change.Old,
+				New:   change.New,
+			})
+		}
+
+		var actorID *uint
+		if entry.ActorID != 0 {
+			actorID = &entry.ActorID
+		}
+
+		history = append(history, dto.HistoryResponse{
+			Version:   entry.Version,
+			Changes:   changes,
+			ActorType: entry.ActorType,
+			ActorID:   actorID,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+
+	return history, nil
+}
+
+// ConfirmEmail consumes a verification token and marks its address as
+// verified, replacing the user's email when the token belongs to a pending
+// change.
+func (s userService) ConfirmEmail(ctx *fiber.Ctx, data dto.ConfirmEmailRequest) error {
+	requestID := ctx.Context().Value("requestid")
+	if err := data.Validate(); err != nil {
+		return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+	}
+
+	tx, err := s.db.Begin(ctx.Context())
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error creating transaction", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// lock verification token
+	verification, err := s.verifyRepo.GetForUpdate(ctx.Context(), tx, helpers.HashToken(data.Token))
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrInvalidVerificationToken) {
+			return helpers.NewResponseError(helpers.ErrInvalidVerificationToken, fiber.StatusBadRequest)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting verification token", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	if !verification.IsValid() {
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInvalidVerificationToken, fiber.StatusBadRequest)
+	}
+
+	// lock current record
+	old, err := s.userRepo.GetForUpdate(ctx.Context(), tx, verification.UserID)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			return helpers.NewResponseError(helpers.ErrInvalidVerificationToken, fiber.StatusBadRequest)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error getting user for update", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// update user record
+	version, err := s.userRepo.ConfirmEmail(ctx.Context(), tx, old.ID, verification.Email)
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return helpers.NewResponseError(helpers.ErrEmailUsed, fiber.StatusConflict)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error confirming email", "error", err, "request_id", requestID)
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// record change history
+	user := domain.User{Email: sql.NullString{String: verification.Email, Valid: true}}
+	changes := helpers.UserChanges(old, user)
+	if len(changes) > 0 {
+		// the verification token proves the user made the change
+		err = s.historyRepo.Insert(ctx.Context(), tx, domain.UserHistory{
+			UserID:    old.ID,
+			Version:   version,
+			Changes:   changes,
+			ActorType: domain.ActorUser,
+			ActorID:   old.ID,
+		})
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error inserting user history", "error", err, "request_id", requestID)
+			tx.Rollback(ctx.Context())
 			return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
 		}
 	}
 
+	// the token proves the request comes from the user
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		ActorType:  domain.ActorUser,
+		ActorID:    old.ID,
+		Action:     domain.AuditUserEmailConfirmed,
+		TargetType: domain.TargetUser,
+		TargetID:   old.ID,
+		Changes:    changes,
+	})
+	if err != nil {
+		tx.Rollback(ctx.Context())
+		return err
+	}
+
+	// the token and any other pending one are spent
+	err = s.verifyRepo.InvalidateByUserID(ctx.Context(), tx, old.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error invalidating verification tokens", "error", err, "request_id", requestID)
+		tx.Rollback(ctx.Context())
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
 	// commit transaction
 	err = tx.Commit(ctx.Context())
 	if err != nil {
@@ -302,3 +810,202 @@ func (s userService) UpdateByID(ctx *fiber.Ctx, data dto.UserRequest) error {
 
 	return nil
 }
+
+// update applies user on top of the locked record old and records the
+// resulting change history. A new email is not written but left pending
+// until confirmed; the verification mails to send after commit are returned.
+// The caller owns tx and rolls it back on error.
+func (s userService) update(ctx *fiber.Ctx, tx pgx.Tx, old, user domain.User) (uint, []mail.Message, error) {
+	requestID := ctx.Context().Value("requestid")
+	var msgs []mail.Message
+
+	// card details are changed by administrators and the card holder only
+	cc := user.CreditCard
+	cardChanged := cc.Type.Valid || cc.Number.Valid || cc.Name.Valid || cc.Expired.Valid
+	if cardChanged {
+		if err := authorize(ctx, domain.ScopeCardsWrite); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// park an email change until the new address is confirmed
+	if user.Email.Valid && user.Email.String != old.Email.String {
+		exists, err := s.userRepo.EmailExists(ctx.Context(), tx, user.Email.String)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error checking email", "error", err, "request_id", requestID)
+			return 0, nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+		if exists {
+			return 0, nil, helpers.NewResponseError(helpers.ErrEmailUsed, fiber.StatusConflict)
+		}
+
+		name := old.Name.String
+		if user.Name.Valid {
+			name = user.Name.String
+		}
+		msg, err := s.createVerification(ctx, tx, old.ID, name, user.Email.String)
+		if err != nil {
+			return 0, nil, err
+		}
+		msgs = append(msgs, msg)
+		user.Email.Valid = false
+	}
+
+	// update user record
+	version, err := s.userRepo.Update(ctx.Context(), tx, old.ID, user)
+	if err != nil {
+		if errors.Is(err, helpers.ErrPreconditionFailed) {
+			return 0, nil, helpers.NewResponseError(helpers.ErrPreconditionFailed, fiber.StatusPreconditionFailed)
+		}
+		s.logger.ErrorContext(ctx.Context(), "error updating user", "error", err, "request_id", requestID)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, nil, helpers.NewResponseError(helpers.ErrEmailUsed, fiber.StatusConflict)
+		}
+		return 0, nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	// card fields apply to the default card
+	if cardChanged {
+		if old.CreditCard.ID == 0 {
+			return 0, nil, helpers.NewResponseError(helpers.ErrCardNotFound, fiber.StatusNotFound)
+		}
+		user.CreditCard.ID = old.CreditCard.ID
+
+		user.CreditCard, err = updateCard(ctx, tx, s.logger, s.vault, s.ccRepo, old.CreditCard, user.CreditCard)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// a new password ends every existing session
+	if user.Password.Valid {
+		err = s.sessionRepo.RevokeAllByUserID(ctx.Context(), tx, old.ID)
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error revoking sessions", "error", err, "request_id", requestID)
+			return 0, nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	// record change history
+	changes := helpers.UserChanges(old, user)
+	if len(changes) > 0 {
+		actorType, actorID := requestActor(ctx)
+		err = s.historyRepo.Insert(ctx.Context(), tx, domain.UserHistory{
+			UserID:    old.ID,
+			Version:   version,
+			Changes:   changes,
+			ActorType: actorType,
+			ActorID:   actorID,
+		})
+		if err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error inserting user history", "error", err, "request_id", requestID)
+			return 0, nil, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+		}
+	}
+
+	err = recordAudit(ctx, tx, s.logger, s.auditRepo, domain.AuditEvent{
+		Action:     domain.AuditUserUpdated,
+		TargetType: domain.TargetUser,
+		TargetID:   old.ID,
+		Changes:    changes,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return version, msgs, nil
+}
+
+// createVerification invalidates the user's pending verification tokens and
+// stores a new one for email, returning the mail that delivers it.
+func (s userService) createVerification(ctx *fiber.Ctx, tx pgx.Tx, userID uint, name, email string) (mail.Message, error) {
+	requestID := ctx.Context().Value("requestid")
+
+	verifyToken, err := helpers.GenerateToken()
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error generating verification token", "error", err, "request_id", requestID)
+		return mail.Message{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+	expiresAt := time.Now().Add(s.conf.Account.EmailVerificationTTL)
+
+	// only the most recently requested address stays confirmable
+	err = s.verifyRepo.InvalidateByUserID(ctx.Context(), tx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error invalidating verification tokens", "error", err, "request_id", requestID)
+		return mail.Message{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	err = s.verifyRepo.Insert(ctx.Context(), tx, domain.EmailVerification{
+		OneTimeToken: domain.OneTimeToken{
+			UserID:    userID,
+			TokenHash: helpers.HashToken(verifyToken),
+			ExpiresAt: expiresAt,
+		},
+		Email: email,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx.Context(), "error inserting verification token", "error", err, "request_id", requestID)
+		return mail.Message{}, helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body:    fmt.Sprintf("Hi %s,\r\n\r\nUse the following token to confirm your email address:\r\n\r\n%s\r\n\r\nThe token expires at %s. If you did not request this, you can ignore this email.\r\n", name, verifyToken, expiresAt.Format(time.RFC1123)),
+	}, nil
+}
+
+// sendMails delivers msgs once their transaction is committed. Failures are
+// only logged, as the change itself already succeeded.
+func (s userService) sendMails(ctx *fiber.Ctx, msgs ...mail.Message) {
+	requestID := ctx.Context().Value("requestid")
+	for _, msg := range msgs {
+		if err := s.mailer.Send(ctx.Context(), msg); err != nil {
+			s.logger.ErrorContext(ctx.Context(), "error sending email", "error", err, "request_id", requestID)
+		}
+	}
+}
+
+// photoResponses lists photos by the URL they are served under.
+func photoResponses(photos []domain.Photo) []dto.PhotoResponse {
+	var resp []dto.PhotoResponse
+	for _, photo := range photos {
+		resp = append(resp, dto.PhotoResponse{
+			URL:       filepath.ToSlash(filepath.Join("/photos", photo.Filepath)),
+			CreatedAt: photo.CreatedAt,
+		})
+	}
+	return resp
+}
+
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// passwordPolicyError turns a failed password policy check into a response.
+// The check only fails internally when the breached password corpus cannot
+// be read.
+func passwordPolicyError(ctx *fiber.Ctx, logger *slog.Logger, err error) error {
+	var internalErr validation.InternalError
+	if errors.As(err, &internalErr) {
+		logger.ErrorContext(ctx.Context(), "error checking password policy", "error", err, "request_id", ctx.Context().Value("requestid"))
+		return helpers.NewResponseError(helpers.ErrInternal, fiber.StatusInternalServerError)
+	}
+
+	return helpers.NewResponseError(helpers.NewValidationError(err), fiber.StatusBadRequest)
+}
+
+// authorize checks that the caller holds scope. The routes check scopes as
+// well, but checking here applies the same rules to every transport.
+func authorize(ctx *fiber.Ctx, scope string) error {
+	principal, ok := ctx.Locals("principal").(domain.Principal)
+	if !ok || !principal.HasScope(scope) {
+		return helpers.NewResponseError(helpers.ErrForbidden, fiber.StatusForbidden)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/domain"
+	"kazokku/internal/helpers"
+	"kazokku/internal/infrastructure/cardbrand"
+	"kazokku/internal/infrastructure/envelope"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CardVault is the only component that sees full card numbers. It seals
+// them away and hands out an opaque token in exchange; the CVV is checked
+// on the way in and then forgotten. Nothing ever leaves the vault.
+type CardVault interface {
+	Tokenize(ctx context.Context, tx pgx.Tx, pan, cvv string) (string, string, error)
+	Import(ctx context.Context, tx pgx.Tx, pan string) (string, error)
+	Delete(ctx context.Context, tx pgx.Tx, token string) error
+}
+
+type cardVault struct {
+	vaultRepo repository.VaultRepository
+	keys      envelope.Keyring
+	brands    cardbrand.Table
+}
+
+func NewCardVault(keys envelope.Keyring, brands cardbrand.Table, vaultRepo repository.VaultRepository) CardVault {
+	return cardVault{
+		vaultRepo: vaultRepo,
+		keys:      keys,
+		brands:    brands,
+	}
+}
+
+// Tokenize verifies pan and cvv against the brand of pan and stores pan,
+// returning its token and the brand. It fails with
+// helpers.ErrInvalidCreditCard when verification fails.
+func (v cardVault) Tokenize(ctx context.Context, tx pgx.Tx, pan, cvv string) (string, string, error) {
+	brand, ok := v.brands.Detect(pan)
+	if !ok || !brand.ValidNumber(pan) || !brand.ValidCVV(cvv) {
+		return "", "", helpers.ErrInvalidCreditCard
+	}
+
+	token, err := v.store(ctx, tx, pan)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, brand.Name, nil
+}
+
+// Import stores pan of a card accepted before the vault existed, whose CVV
+// is gone.
+func (v cardVault) Import(ctx context.Context, tx pgx.Tx, pan string) (string, error) {
+	return v.store(ctx, tx, pan)
+}
+
+// Delete forgets the card behind token.
+func (v cardVault) Delete(ctx context.Context, tx pgx.Tx, token string) error {
+	return v.vaultRepo.Delete(ctx, tx, token)
+}
+
+func (v cardVault) store(ctx context.Context, tx pgx.Tx, pan string) (string, error) {
+	token, err := helpers.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	token = "card_" + token
+
+	sealed, err := v.keys.Seal([]byte(pan), vaultAdditionalData(token))
+	if err != nil {
+		return "", err
+	}
+
+	err = v.vaultRepo.Insert(ctx, tx, domain.VaultEntry{Token: token, Sealed: sealed})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// the token is authenticated with the number, so a ciphertext copied to
+// another entry does not decrypt
+func vaultAdditionalData(token string) []byte {
+	return []byte("card_vault:" + token)
+}
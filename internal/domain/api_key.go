@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+)
+
+const (
+	ScopeUsersRead       = "users:read"
+	ScopeUsersWrite      = "users:write"
+	ScopeUsersRegister   = "users:register"
+	ScopeUsersDelete     = "users:delete"
+	ScopeUsersAdmin      = "users:admin"
+	ScopeCardsReadMasked = "cards:read_masked"
+	ScopeCardsWrite      = "cards:write"
+	ScopeKeysManage      = "keys:manage"
+	ScopeAuditRead       = "audit:read"
+)
+
+const (
+	AuthModeBearer = "bearer"
+	AuthModeHMAC   = "hmac"
+)
+
+// Scopes lists every scope an API key can be granted.
+var Scopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeUsersRegister, ScopeUsersDelete, ScopeUsersAdmin, ScopeCardsReadMasked, ScopeCardsWrite, ScopeKeysManage, ScopeAuditRead}
+
+type ApiKey struct {
+	ID                               uint
+	Name, Owner, KeyHash             string
+	Scopes                           []string
+	Role, AuthMode, HMACSalt         string
+	CreatedAt                        time.Time
+	RotatedAt, ExpiresAt, LastUsedAt sql.NullTime
+	RevokedAt                        sql.NullTime
+}
+
+func (k ApiKey) IsActive() bool {
+	return !k.RevokedAt.Valid && (!k.ExpiresAt.Valid || time.Now().Before(k.ExpiresAt.Time))
+}
+
+func (k ApiKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) && RoleAllows(k.Role, scope)
+}
+
+// EffectiveScopes returns the scopes of the key that its role allows.
+func (k ApiKey) EffectiveScopes() []string {
+	var scopes []string
+	for _, scope := range k.Scopes {
+		if RoleAllows(k.Role, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
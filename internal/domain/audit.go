@@ -0,0 +1,60 @@
+package domain
+
+import "time"
+
+const (
+	ActorApiKey    = "api_key"
+	ActorUser      = "user"
+	ActorAnonymous = "anonymous"
+	ActorSystem    = "system"
+)
+
+const (
+	TargetUser    = "user"
+	TargetApiKey  = "api_key"
+	TargetSession = "session"
+	TargetCard    = "credit_card"
+	TargetIP      = "ip"
+)
+
+const (
+	AuditUserCreated            = "user.created"
+	AuditUserUpdated            = "user.updated"
+	AuditUserDeleted            = "user.deleted"
+	AuditUserRestored           = "user.restored"
+	AuditUserPurged             = "user.purged"
+	AuditUserEmailConfirmed     = "user.email_confirmed"
+	AuditUserLocked             = "user.locked"
+	AuditUserUnlocked           = "user.unlocked"
+	AuditPasswordResetRequested = "user.password_reset_requested"
+	AuditPasswordReset          = "user.password_reset"
+	AuditTwoFactorEnrolled      = "user.two_factor_enrolled"
+	AuditTwoFactorEnabled       = "user.two_factor_enabled"
+	AuditTwoFactorReset         = "user.two_factor_reset"
+	AuditSessionCreated         = "session.created"
+	AuditSessionChallenged      = "session.challenged"
+	AuditSessionRefreshed       = "session.refreshed"
+	AuditSessionRevoked         = "session.revoked"
+	AuditApiKeyCreated          = "api_key.created"
+	AuditApiKeyRotated          = "api_key.rotated"
+	AuditApiKeyScopesUpdated    = "api_key.scopes_updated"
+	AuditApiKeyRoleUpdated      = "api_key.role_updated"
+	AuditApiKeyRevoked          = "api_key.revoked"
+	AuditCardCreated            = "credit_card.created"
+	AuditCardUpdated            = "credit_card.updated"
+	AuditCardDeleted            = "credit_card.deleted"
+	AuditIPLocked               = "ip.locked"
+)
+
+// AuditEvent records who changed what. Events are append-only; Changes uses
+// the same redaction as the user history, so secrets never carry values.
+type AuditEvent struct {
+	ID                    uint
+	ActorType             string
+	ActorID               uint
+	RequestID, IP, Action string
+	TargetType            string
+	TargetID              uint
+	Changes               []FieldChange
+	CreatedAt             time.Time
+}
@@ -2,7 +2,31 @@ package domain
 
 import "database/sql"
 
+// CreditCard is a card as stored with its user. The number lives in the
+// vault under Token; Number and CVV are only set on cards received in a
+// request, on their way to the vault, and are never stored.
 type CreditCard struct {
-	UserID                           uint
-	Type, Number, Name, Expired, CVV sql.NullString
+	ID, UserID                        uint
+	Type, Name, Expired, Token, Last4 sql.NullString
+	Number, CVV                       sql.NullString
+	IsDefault                         bool
+	// Sealed holds the number, expiry and CVV of a card encrypted before
+	// the vault existed, until it is moved there.
+	Sealed               Envelope
+	CreatedAt, UpdatedAt sql.NullTime
+}
+
+func (c CreditCard) IsEmpty() bool {
+	return c.ID == 0 && c.UserID == 0 && c.Type == (sql.NullString{}) && c.Name == (sql.NullString{}) && c.Expired == (sql.NullString{}) && c.Token == (sql.NullString{}) && c.Last4 == (sql.NullString{}) && c.Number == (sql.NullString{}) && c.CVV == (sql.NullString{}) && !c.IsDefault && c.Sealed.IsEmpty() && c.CreatedAt == (sql.NullTime{}) && c.UpdatedAt == (sql.NullTime{})
+}
+
+// Envelope is a record encrypted under its own data key, stored wrapped by
+// the master key KeyID.
+type Envelope struct {
+	KeyID                      string
+	DataKey, Nonce, Ciphertext []byte
+}
+
+func (e Envelope) IsEmpty() bool {
+	return e.Ciphertext == nil
 }
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// FieldChange describes a single field modified by an update. Old and New are
+// nil for secrets whose values must never be recorded.
+type FieldChange struct {
+	Field string  `json:"field"`
+	Old   *string `json:"old"`
+	New   *string `json:"new"`
+}
+
+// UserHistory is one version of a user. ActorType and ActorID say who made
+// the change, the same way they do on an AuditEvent; they are empty on
+// entries recorded before actors were.
+type UserHistory struct {
+	UserID    uint
+	Version   uint
+	Changes   []FieldChange
+	ActorType string
+	ActorID   uint
+	CreatedAt time.Time
+}
@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+)
+
+// KeyRotation is the progress of re-wrapping the vault under the master key
+// KeyID. Entries up to LastEntryID have been handled.
+type KeyRotation struct {
+	KeyID                string
+	LastEntryID          uint
+	Rotated              int64
+	StartedAt, UpdatedAt time.Time
+	CompletedAt          sql.NullTime
+}
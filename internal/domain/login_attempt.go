@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	LoginAttemptAccount = "account"
+	LoginAttemptIP      = "ip"
+)
+
+// LoginAttempt counts recent failed logins of an account or client IP.
+type LoginAttempt struct {
+	Scope, Subject            string
+	Failures                  uint
+	LastFailedAt              time.Time
+	DelayedUntil, LockedUntil sql.NullTime
+}
+
+func (a LoginAttempt) IsLocked() bool {
+	return a.LockedUntil.Valid && time.Now().Before(a.LockedUntil.Time)
+}
+
+func (a LoginAttempt) IsDelayed() bool {
+	return a.DelayedUntil.Valid && time.Now().Before(a.DelayedUntil.Time)
+}
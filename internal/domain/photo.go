@@ -1,6 +1,9 @@
 package domain
 
+import "time"
+
 type Photo struct {
-	UserID   uint
-	Filepath string
+	UserID    uint
+	Filepath  string
+	CreatedAt time.Time
 }
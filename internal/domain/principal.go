@@ -0,0 +1,20 @@
+package domain
+
+import "slices"
+
+// SelfScopes are granted to users authenticated with their own access token,
+// which the middleware already restricts to their own record.
+var SelfScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeCardsReadMasked, ScopeCardsWrite}
+
+// Principal is the authenticated caller of a request, either an API key or
+// a user acting on their own record. Scopes are already limited by Role.
+type Principal struct {
+	ApiKeyID uint
+	UserID   uint
+	Role     string
+	Scopes   []string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
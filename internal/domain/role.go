@@ -0,0 +1,31 @@
+package domain
+
+import "slices"
+
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleAuditor = "auditor"
+)
+
+// Roles lists every role an API key can be bound to.
+var Roles = []string{RoleAdmin, RoleSupport, RoleAuditor}
+
+// RoleScopes are the most a key bound to each role may do. Support staff
+// view and edit users but never see or change card details, only
+// administrators do. Auditors only read users and the audit log.
+var RoleScopes = map[string][]string{
+	RoleAdmin:   Scopes,
+	RoleSupport: {ScopeUsersRead, ScopeUsersWrite},
+	RoleAuditor: {ScopeUsersRead, ScopeCardsReadMasked, ScopeAuditRead},
+}
+
+// RoleAllows reports whether a key bound to role may hold scope. Keys
+// without a role predate roles and are limited by their scopes alone.
+func RoleAllows(role, scope string) bool {
+	if role == "" {
+		return true
+	}
+
+	return slices.Contains(RoleScopes[role], scope)
+}
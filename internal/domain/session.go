@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Session struct {
+	ID                               uint
+	UserID                           uint
+	UserAgent, IP                    string
+	CreatedAt, LastUsedAt, ExpiresAt time.Time
+	RevokedAt                        sql.NullTime
+}
+
+func (s Session) IsActive() bool {
+	return !s.RevokedAt.Valid && time.Now().Before(s.ExpiresAt)
+}
+
+type RefreshToken struct {
+	ID        uint
+	SessionID uint
+	UsedAt    sql.NullTime
+}
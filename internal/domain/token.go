@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+)
+
+// OneTimeToken is a single-use, expiring token such as a password reset token.
+type OneTimeToken struct {
+	ID        uint
+	UserID    uint
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+func (t OneTimeToken) IsValid() bool {
+	return !t.UsedAt.Valid && time.Now().Before(t.ExpiresAt)
+}
+
+// EmailVerification confirms that the user controls Email, either the address
+// they registered with or a pending change of it.
+type EmailVerification struct {
+	OneTimeToken
+	Email string
+}
+
+const (
+	MFAPurposeVerify = "verify"
+	MFAPurposeEnrol  = "enrol"
+)
+
+// MFAChallenge is handed out by a login whose password was correct but
+// which still needs a second factor, or an enrolment in one first.
+type MFAChallenge struct {
+	OneTimeToken
+	Purpose string
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"database/sql"
+)
+
+// TOTP is the two-factor state of a user. Secret is encrypted; it is set
+// but not yet enabled while an enrolment awaits confirmation.
+type TOTP struct {
+	UserID    uint
+	Secret    []byte
+	EnabledAt sql.NullTime
+	LastStep  int64
+}
+
+func (t TOTP) IsEnabled() bool {
+	return t.EnabledAt.Valid
+}
+
+func (t TOTP) IsPending() bool {
+	return t.Secret != nil && !t.EnabledAt.Valid
+}
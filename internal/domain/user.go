@@ -1,14 +1,21 @@
 package domain
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 type User struct {
 	ID                             uint
+	Version                        uint
 	Name, Address, Email, Password sql.NullString
 	Photos                         []Photo
-	CreditCard                     CreditCard
+	CreditCard                     CreditCard // the default card
+	EmailVerifiedAt                sql.NullTime
+	TOTPEnabledAt                  sql.NullTime
+	CreatedAt, UpdatedAt           time.Time
 }
 
 func (u User) IsEmpty() bool {
-	return u.ID == 0 && u.Name.String == "" && u.Address.String == "" && u.Email.String == "" && u.Password.String == "" && u.Photos == nil && u.CreditCard == (CreditCard{})
+	return u.ID == 0 && u.Name.String == "" && u.Address.String == "" && u.Email.String == "" && u.Password.String == "" && u.Photos == nil && u.CreditCard.IsEmpty()
 }
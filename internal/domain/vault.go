@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+// VaultEntry is a card number kept in the vault, sealed and known outside
+// of it only by Token.
+type VaultEntry struct {
+	ID        uint
+	Token     string
+	Sealed    Envelope
+	CreatedAt time.Time
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"database/sql"
+	"kazokku/internal/domain"
+	"strings"
+	"time"
+)
+
+// ApiKeyChanges lists the fields of old that data would modify. The key
+// itself is a secret and recorded without values.
+func ApiKeyChanges(old, data domain.ApiKey) []domain.FieldChange {
+	var changes []domain.FieldChange
+
+	changes = appendChange(changes, "name", validString(old.Name), validString(data.Name))
+	changes = appendChange(changes, "owner", validString(old.Owner), validString(data.Owner))
+	changes = appendChange(changes, "role", validString(old.Role), validString(data.Role))
+	changes = appendChange(changes, "scopes", validString(strings.Join(old.Scopes, ",")), validString(strings.Join(data.Scopes, ",")))
+	changes = appendChange(changes, "auth_mode", validString(old.AuthMode), validString(data.AuthMode))
+	changes = appendChange(changes, "expires_at", formatNullTime(old.ExpiresAt), formatNullTime(data.ExpiresAt))
+	if data.KeyHash != old.KeyHash {
+		changes = append(changes, domain.FieldChange{Field: "key"})
+	}
+
+	return changes
+}
+
+func validString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+func formatNullTime(t sql.NullTime) sql.NullString {
+	if !t.Valid {
+		return sql.NullString{Valid: true}
+	}
+	return validString(t.Time.Format(time.RFC3339))
+}
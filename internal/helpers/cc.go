@@ -1,8 +1,15 @@
 package helpers
 
+import "strings"
+
 func GetLast4Digits(ccNumber string) string {
 	if len(ccNumber) < 4 {
 		return ccNumber
 	}
 	return ccNumber[len(ccNumber)-4:]
 }
+
+func MaskCardNumber(ccNumber string) string {
+	last4 := GetLast4Digits(ccNumber)
+	return strings.Repeat("*", len(ccNumber)-len(last4)) + last4
+}
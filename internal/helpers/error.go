@@ -3,14 +3,37 @@ package helpers
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
 var (
-	ErrInternal          = errors.New("Something went wrong. Please try again later.")
-	ErrInvalidCreditCard = errors.New("Credit card data invalid.")
-	ErrUserNotFound      = errors.New("User not found.")
-	ErrEmailUsed         = errors.New("User with provided email already exists.")
+	ErrInternal                 = errors.New("Something went wrong. Please try again later.")
+	ErrInvalidCreditCard        = errors.New("Credit card data invalid.")
+	ErrUserNotFound             = errors.New("User not found.")
+	ErrCardNotFound             = errors.New("Credit card not found.")
+	ErrEmailUsed                = errors.New("User with provided email already exists.")
+	ErrPreconditionFailed       = errors.New("User has been modified since it was retrieved.")
+	ErrPreconditionRequired     = errors.New("Please provide If-Match header.")
+	ErrInvalidPatch             = errors.New("Patch document invalid.")
+	ErrInvalidCredentials       = errors.New("Invalid email or password.")
+	ErrInvalidRefreshToken      = errors.New("Invalid refresh token.")
+	ErrSessionNotFound          = errors.New("Session not found.")
+	ErrInvalidResetToken        = errors.New("Invalid or expired password reset token.")
+	ErrInvalidVerificationToken = errors.New("Invalid or expired email verification token.")
+	ErrApiKeyNotFound           = errors.New("API key not found.")
+	ErrHMACDisabled             = errors.New("Request signing is not configured.")
+	ErrTooManyRequests          = errors.New("Too many requests. Please try again later.")
+	ErrTooManyLoginAttempts     = errors.New("Too many failed login attempts. Please try again later.")
+	ErrAccountLocked            = errors.New("Account is temporarily locked after too many failed login attempts.")
+	ErrInvalidMFAToken          = errors.New("Invalid or expired two-factor challenge.")
+	ErrInvalidMFACode           = errors.New("Invalid two-factor code.")
+	ErrTOTPAlreadyEnabled       = errors.New("Two-factor authentication is already enabled.")
+	ErrTOTPNotPending           = errors.New("Two-factor enrolment has not been started.")
+	ErrForbidden                = errors.New("You are not allowed to perform this action.")
+	ErrScopeNotAllowed          = errors.New("Scopes exceed what the role of the API key allows.")
 )
 
 type ResponseError struct {
@@ -51,11 +74,33 @@ func (e ValidationError) Error() string {
 	return e.msg.Error()
 }
 
+// ErrSlice returns one message per invalid field. Most only name the field,
+// but password policy and card brand violations explain themselves, since
+// supplying the field again does not help.
 func (e ValidationError) ErrSlice() []string {
-	errors := make([]string, 0)
-	for _, err := range strings.Split(e.Error(), ";") {
-		errors = append(errors, fmt.Sprintf("Please provide %s field.", strings.Split(err, ":")[0]))
+	msgs := make([]string, 0)
+	var fields validation.Errors
+	if !errors.As(e.msg, &fields) {
+		for _, err := range strings.Split(e.Error(), ";") {
+			msgs = append(msgs, fmt.Sprintf("Please provide %s field.", strings.Split(err, ":")[0]))
+		}
+		return msgs
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var ruleErr validation.Error
+		if errors.As(fields[name], &ruleErr) && (strings.HasPrefix(ruleErr.Code(), "validation_password_") || strings.HasPrefix(ruleErr.Code(), "validation_card_")) {
+			msgs = append(msgs, fmt.Sprintf("%s%s %s.", strings.ToUpper(name[:1]), name[1:], ruleErr.Error()))
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("Please provide %s field.", name))
 	}
 
-	return errors
+	return msgs
 }
@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func FormatETag(version uint) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ParseETag returns the version held by an entity tag produced by FormatETag.
+// The wildcard "*" matches any version and is returned as 0.
+func ParseETag(etag string) (uint, error) {
+	etag = strings.TrimSpace(etag)
+	if etag == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), 10, 32)
+	if err != nil || version == 0 {
+		return 0, ErrPreconditionFailed
+	}
+
+	return uint(version), nil
+}
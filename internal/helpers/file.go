@@ -41,3 +41,7 @@ func SaveFile(userID uint, file *multipart.FileHeader) (string, error) {
 func IsImage(fileType string) bool {
 	return strings.HasPrefix(fileType, "image/")
 }
+
+func RemoveUserFiles(userID uint) error {
+	return os.RemoveAll(filepath.Join(os.Getenv("SAVE_DIR"), "photos", fmt.Sprintf("%d", userID)))
+}
@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"database/sql"
+	"kazokku/internal/domain"
+)
+
+// UserChanges lists the fields of old that an update with data would modify.
+// Credit card numbers are masked to their last four digits and secrets are
+// recorded without values.
+func UserChanges(old domain.User, data domain.User) []domain.FieldChange {
+	var changes []domain.FieldChange
+
+	changes = appendChange(changes, "name", old.Name, data.Name)
+	changes = appendChange(changes, "address", old.Address, data.Address)
+	changes = appendChange(changes, "email", old.Email, data.Email)
+	if data.Password.Valid {
+		changes = append(changes, domain.FieldChange{Field: "password"})
+	}
+
+	return append(changes, CardChanges(old.CreditCard, data.CreditCard)...)
+}
+
+// CardChanges lists the fields of the card oldCC that an update with newCC
+// would modify, masked like UserChanges.
+func CardChanges(oldCC, newCC domain.CreditCard) []domain.FieldChange {
+	var changes []domain.FieldChange
+
+	changes = appendChange(changes, "creditcard_type", oldCC.Type, newCC.Type)
+	// only the last four digits of the stored number are known
+	if newCC.Number.Valid {
+		var oldNumber string
+		if oldCC.Last4.Valid {
+			oldNumber = "************" + oldCC.Last4.String
+		}
+		newNumber := MaskCardNumber(newCC.Number.String)
+		changes = append(changes, domain.FieldChange{Field: "creditcard_number", Old: &oldNumber, New: &newNumber})
+	}
+	changes = appendChange(changes, "creditcard_name", oldCC.Name, newCC.Name)
+	changes = appendChange(changes, "creditcard_expired", oldCC.Expired, newCC.Expired)
+	if newCC.CVV.Valid {
+		changes = append(changes, domain.FieldChange{Field: "creditcard_cvv"})
+	}
+	if newCC.IsDefault && !oldCC.IsDefault {
+		oldDefault, newDefault := "false", "true"
+		changes = append(changes, domain.FieldChange{Field: "creditcard_default", Old: &oldDefault, New: &newDefault})
+	}
+
+	return changes
+}
+
+func appendChange(changes []domain.FieldChange, field string, old, new sql.NullString) []domain.FieldChange {
+	if !new.Valid || new.String == old.String {
+		return changes
+	}
+
+	oldValue, newValue := old.String, new.String
+	return append(changes, domain.FieldChange{Field: field, Old: &oldValue, New: &newValue})
+}
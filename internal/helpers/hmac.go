@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// HMACScheme is the Authorization scheme of signed requests.
+const HMACScheme = "KAZOKKU-HMAC"
+
+// DeriveHMACSecret returns the signing secret of a key from the server's
+// master secret and the key's salt, so the secret itself is never stored.
+func DeriveHMACSecret(master, salt string) string {
+	mac := hmac.New(sha256.New, []byte(master))
+	mac.Write([]byte(salt))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest returns the hex encoded HMAC-SHA256 over the canonical form
+// of a request:
+//
+//	METHOD\nPATH?QUERY\nTIMESTAMP\nNONCE\nHEX(SHA256(BODY))
+func SignRequest(secret, method, path string, timestamp int64, nonce string, body []byte) string {
+	digest := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ParseHMACAuthorization splits the parameters of a
+// "KAZOKKU-HMAC keyId=..., timestamp=..., nonce=..., signature=..." header.
+func ParseHMACAuthorization(header string) (map[string]string, bool) {
+	params, ok := strings.CutPrefix(header, HMACScheme+" ")
+	if !ok {
+		return nil, false
+	}
+
+	values := make(map[string]string)
+	for _, param := range strings.Split(params, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return nil, false
+		}
+		values[name] = value
+	}
+
+	return values, true
+}
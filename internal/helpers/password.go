@@ -1,12 +0,0 @@
-package helpers
-
-import "golang.org/x/crypto/bcrypt"
-
-func HashPassword(raw string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.MinCost)
-	if err != nil {
-		return "", err
-	}
-
-	return string(hashed), nil
-}
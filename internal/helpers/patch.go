@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"encoding/json"
+	"kazokku/internal/app/delivery/dto"
+	"mime"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+func IsPatchContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == MergePatchContentType || mediaType == JSONPatchContentType
+}
+
+// ApplyUserPatch applies a JSON Merge Patch (RFC 7396) or JSON Patch
+// (RFC 6902) document to doc, depending on contentType.
+func ApplyUserPatch(doc dto.UserPatchDocument, contentType string, patch []byte) (dto.UserRequest, error) {
+	var patched dto.UserRequest
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return patched, err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return patched, ErrInvalidPatch
+	}
+
+	var modified []byte
+	switch mediaType {
+	case MergePatchContentType:
+		modified, err = jsonpatch.MergePatch(original, patch)
+	case JSONPatchContentType:
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			modified, err = ops.Apply(original)
+		}
+	default:
+		err = ErrInvalidPatch
+	}
+	if err != nil {
+		return patched, ErrInvalidPatch
+	}
+
+	if err := json.Unmarshal(modified, &patched); err != nil {
+		return patched, ErrInvalidPatch
+	}
+
+	return patched, nil
+}
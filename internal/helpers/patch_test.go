@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"database/sql"
+	"errors"
+	"kazokku/internal/app/delivery/dto"
+	"kazokku/internal/domain"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+func patchUser(t *testing.T, doc dto.UserPatchDocument, hasCard bool, patch string) error {
+	t.Helper()
+	patched, err := ApplyUserPatch(doc, MergePatchContentType, []byte(patch))
+	if err != nil {
+		t.Fatalf("applying %s: %v", patch, err)
+	}
+	patched.UserID = 1
+
+	return patched.ValidatePatch(hasCard)
+}
+
+func TestValidatePatchClearing(t *testing.T) {
+	doc := dto.UserPatchDocument{
+		Name:              "Jane Doe",
+		Address:           "Jl. Sudirman 1",
+		Email:             "jane@example.com",
+		CreditCardType:    "visa",
+		CreditCardName:    "Jane Doe",
+		CreditCardExpired: "12/99",
+	}
+
+	if err := patchUser(t, doc, true, `{"address": null}`); err != nil {
+		t.Errorf("clearing address: %v", err)
+	}
+	if err := patchUser(t, doc, true, `{"creditcard_type": ""}`); err != nil {
+		t.Errorf("clearing creditcard_type: %v", err)
+	}
+
+	for _, field := range []string{"name", "email", "creditcard_name", "creditcard_expired"} {
+		err := patchUser(t, doc, true, `{"`+field+`": null}`)
+		var errs validation.Errors
+		if !errors.As(err, &errs) || errs[field] == nil {
+			t.Errorf("clearing %s: got %v, want an error on %s", field, err, field)
+		}
+	}
+}
+
+func TestPatchAfterLastCardDeleted(t *testing.T) {
+	user := domain.User{
+		ID:      1,
+		Name:    sql.NullString{String: "Jane Doe", Valid: true},
+		Address: sql.NullString{String: "Jl. Sudirman 1", Valid: true},
+		Email:   sql.NullString{String: "jane@example.com", Valid: true},
+	}
+	doc := UserDomainToPatchDocument(user)
+
+	patched, err := ApplyUserPatch(doc, MergePatchContentType, []byte(`{"name": "Jane Smith"}`))
+	if err != nil {
+		t.Fatalf("applying patch: %v", err)
+	}
+	patched.UserID = user.ID
+
+	if err := patched.ValidatePatch(user.CreditCard.ID != 0); err != nil {
+		t.Fatalf("patching a user without cards: %v", err)
+	}
+
+	changed := UserPatchDTOtoUserDomain(patched, doc)
+	if !changed.Name.Valid || changed.Name.String != "Jane Smith" {
+		t.Errorf("name: got %+v, want Jane Smith", changed.Name)
+	}
+	card := changed.CreditCard
+	if card.Type.Valid || card.Number.Valid || card.Name.Valid || card.Expired.Valid || card.CVV.Valid {
+		t.Errorf("card fields marked as changed: %+v", card)
+	}
+}
@@ -108,3 +108,114 @@ func UserUpdateDTOtoCCDomain(data dto.UserRequest, userID uint) domain.CreditCar
 
 	return cc
 }
+
+func CreditCardDTOtoDomain(data dto.CreditCardRequest) domain.CreditCard {
+	var cc domain.CreditCard
+
+	cc.UserID = data.UserID
+	cc.Type = sql.NullString{
+		String: data.Type,
+		Valid:  data.Type != "",
+	}
+	cc.Number = sql.NullString{
+		String: data.Number,
+		Valid:  data.Number != "",
+	}
+	cc.Name = sql.NullString{
+		String: data.Name,
+		Valid:  data.Name != "",
+	}
+	cc.Expired = sql.NullString{
+		String: data.Expired,
+		Valid:  data.Expired != "",
+	}
+	cc.CVV = sql.NullString{
+		String: data.CVV,
+		Valid:  data.CVV != "",
+	}
+	cc.IsDefault = data.Default
+
+	return cc
+}
+
+func UserDomainToPatchDocument(user domain.User) dto.UserPatchDocument {
+	return dto.UserPatchDocument{
+		Name:              user.Name.String,
+		Address:           user.Address.String,
+		Email:             user.Email.String,
+		CreditCardType:    user.CreditCard.Type.String,
+		CreditCardName:    user.CreditCard.Name.String,
+		CreditCardExpired: user.CreditCard.Expired.String,
+	}
+}
+
+// UserPatchDTOtoUserDomain marks every field of patched that differs from old
+// as provided, so a field cleared by the patch is written as an empty value.
+func UserPatchDTOtoUserDomain(patched dto.UserRequest, old dto.UserPatchDocument) domain.User {
+	var user domain.User
+
+	user.ID = patched.UserID
+	user.Name = sql.NullString{
+		String: patched.Name,
+		Valid:  patched.Name != old.Name,
+	}
+	user.Address = sql.NullString{
+		String: patched.Address,
+		Valid:  patched.Address != old.Address,
+	}
+	user.Email = sql.NullString{
+		String: patched.Email,
+		Valid:  patched.Email != old.Email,
+	}
+	user.Password = sql.NullString{
+		String: patched.Password,
+		Valid:  patched.Password != "",
+	}
+
+	user.CreditCard.UserID = patched.UserID
+	user.CreditCard.Type = sql.NullString{
+		String: patched.CreditCardType,
+		Valid:  patched.CreditCardType != old.CreditCardType,
+	}
+	user.CreditCard.Number = sql.NullString{
+		String: patched.CreditCardNumber,
+		Valid:  patched.CreditCardNumber != "",
+	}
+	user.CreditCard.Name = sql.NullString{
+		String: patched.CreditCardName,
+		Valid:  patched.CreditCardName != old.CreditCardName,
+	}
+	user.CreditCard.Expired = sql.NullString{
+		String: patched.CreditCardExpired,
+		Valid:  patched.CreditCardExpired != old.CreditCardExpired,
+	}
+	user.CreditCard.CVV = sql.NullString{
+		String: patched.CreditCardCVV,
+		Valid:  patched.CreditCardCVV != "",
+	}
+
+	return user
+}
+
+// UserDomainToChangedDTO returns the provided fields of user, leaving the
+// others empty, so the update validation rules only see changed values.
+func UserDomainToChangedDTO(user domain.User) dto.UserRequest {
+	provided := func(s sql.NullString) string {
+		if !s.Valid {
+			return ""
+		}
+		return s.String
+	}
+
+	return dto.UserRequest{
+		UserID:            user.ID,
+		Name:              provided(user.Name),
+		Address:           provided(user.Address),
+		Email:             provided(user.Email),
+		CreditCardType:    provided(user.CreditCard.Type),
+		CreditCardNumber:  provided(user.CreditCard.Number),
+		CreditCardName:    provided(user.CreditCard.Name),
+		CreditCardExpired: provided(user.CreditCard.Expired),
+		CreditCardCVV:     provided(user.CreditCard.CVV),
+	}
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateToken returns a random URL-safe token suitable for refresh, reset
+// and verification tokens.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest under which a token is
+// stored, so a database dump does not reveal usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateApiKey returns a new API key. The prefix makes keys recognisable
+// in configuration files and secret scanners.
+func GenerateApiKey() (string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	return "kzk_" + token, nil
+}
@@ -0,0 +1,296 @@
+package cardbrand
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"kazokku/internal/utils"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Codes of the errors the rules return. They share the validation_card_
+// prefix, which tells ValidationError to show their message to the client.
+const (
+	CodeInvalid  = "validation_card_invalid"
+	CodeUnknown  = "validation_card_unknown"
+	CodeLength   = "validation_card_length"
+	CodeMismatch = "validation_card_mismatch"
+	CodeCVV      = "validation_card_cvv"
+)
+
+//go:embed bins.csv
+var defaultRanges []byte
+
+// aliases maps other spellings of a brand to the name the table uses.
+var aliases = map[string]string{
+	"american express": "amex",
+	"diners club":      "diners",
+	"union pay":        "unionpay",
+	"china unionpay":   "unionpay",
+}
+
+// Brand is what a BIN range says about the cards in it.
+type Brand struct {
+	Name      string
+	Lengths   []int
+	CVVLength int
+}
+
+// ValidNumber reports whether pan is all digits, has a length cards of b
+// are issued with and passes the Luhn check.
+func (b Brand) ValidNumber(pan string) bool {
+	if !digits(pan) || !slices.Contains(b.Lengths, len(pan)) {
+		return false
+	}
+
+	return luhn(pan)
+}
+
+// ValidCVV reports whether cvv has the length cards of b print.
+func (b Brand) ValidCVV(cvv string) bool {
+	return digits(cvv) && len(cvv) == b.CVVLength
+}
+
+type binRange struct {
+	start string
+	end   string
+	brand Brand
+}
+
+// Table finds the brand of a card from the leading digits of its number,
+// the bank or issuer identification number.
+type Table struct {
+	ranges []binRange
+	names  map[string]bool
+}
+
+// New loads the ranges from CARD_BIN_FILE, or the ones built in when unset.
+// The file has the format of bins.csv and replaces the built-in ranges as a
+// whole.
+func New(conf utils.Card) (Table, error) {
+	if conf.BINFile == "" {
+		return parse(bytes.NewReader(defaultRanges))
+	}
+
+	file, err := os.Open(conf.BINFile)
+	if err != nil {
+		return Table{}, err
+	}
+	defer file.Close()
+
+	t, err := parse(file)
+	if err != nil {
+		return t, fmt.Errorf("CARD_BIN_FILE: %w", err)
+	}
+
+	return t, nil
+}
+
+func parse(r io.Reader) (Table, error) {
+	t := Table{names: make(map[string]bool)}
+
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 5
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return t, err
+	}
+
+	for _, record := range records {
+		name := strings.ToLower(strings.TrimSpace(record[0]))
+		start, end := strings.TrimSpace(record[1]), strings.TrimSpace(record[2])
+		if name == "" {
+			return t, fmt.Errorf("range %s-%s has no brand", start, end)
+		}
+		if start == "" || len(start) != len(end) || !digits(start) || !digits(end) || start > end {
+			return t, fmt.Errorf("%s: invalid range %s-%s", name, start, end)
+		}
+
+		lengths, err := parseLengths(record[3])
+		if err != nil {
+			return t, fmt.Errorf("%s: %w", name, err)
+		}
+
+		cvvLength, err := strconv.Atoi(strings.TrimSpace(record[4]))
+		if err != nil || cvvLength < 3 || cvvLength > 4 {
+			return t, fmt.Errorf("%s: CVV length must be 3 or 4", name)
+		}
+
+		t.ranges = append(t.ranges, binRange{
+			start: start,
+			end:   end,
+			brand: Brand{Name: name, Lengths: lengths, CVVLength: cvvLength},
+		})
+		t.names[name] = true
+	}
+
+	if len(t.ranges) == 0 {
+		return t, errors.New("no BIN ranges")
+	}
+
+	return t, nil
+}
+
+// parseLengths reads lengths such as "13|16|19" or "16-19".
+func parseLengths(s string) ([]int, error) {
+	var lengths []int
+	for _, part := range strings.Split(s, "|") {
+		from, to, isSpan := strings.Cut(strings.TrimSpace(part), "-")
+		if !isSpan {
+			to = from
+		}
+
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lengths %q", s)
+		}
+		last, err := strconv.Atoi(to)
+		if err != nil || first < 12 || last > 19 || first > last {
+			return nil, fmt.Errorf("invalid lengths %q", s)
+		}
+
+		for n := first; n <= last; n++ {
+			lengths = append(lengths, n)
+		}
+	}
+
+	return lengths, nil
+}
+
+// Detect returns the brand of the card numbered pan. When ranges overlap,
+// the one with the longest prefix wins.
+func (t Table) Detect(pan string) (Brand, bool) {
+	var found binRange
+	for _, r := range t.ranges {
+		if len(pan) < len(r.start) || len(r.start) <= len(found.start) {
+			continue
+		}
+		prefix := pan[:len(r.start)]
+		if prefix >= r.start && prefix <= r.end {
+			found = r
+		}
+	}
+
+	return found.brand, found.start != ""
+}
+
+// Normalize returns the name the table uses for the brand cardType, which
+// is matched regardless of case and may be a common alias.
+func (t Table) Normalize(cardType string) (string, bool) {
+	name := strings.ToLower(strings.Join(strings.Fields(cardType), " "))
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+
+	return name, t.names[name]
+}
+
+// TypeRule accepts the brands in the table. Empty values pass.
+func (t Table) TypeRule() validation.Rule {
+	return validation.By(func(value any) error {
+		cardType, _ := value.(string)
+		if cardType == "" {
+			return nil
+		}
+		if _, ok := t.Normalize(cardType); !ok {
+			return validation.NewError(CodeUnknown, "is not a supported card brand")
+		}
+		return nil
+	})
+}
+
+// NumberRule accepts numbers of a known brand with a valid length and check
+// digit. When cardType is given, the number must belong to that brand.
+// Empty values pass.
+func (t Table) NumberRule(cardType string) validation.Rule {
+	return validation.By(func(value any) error {
+		pan, _ := value.(string)
+		if pan == "" {
+			return nil
+		}
+		if !digits(pan) || !luhn(pan) {
+			return validation.NewError(CodeInvalid, "must be a valid card number")
+		}
+
+		brand, ok := t.Detect(pan)
+		if !ok {
+			return validation.NewError(CodeUnknown, "is not from a supported card brand")
+		}
+		if !slices.Contains(brand.Lengths, len(pan)) {
+			return validation.NewError(CodeLength, "has the wrong length for {{.brand}}").SetParams(map[string]any{"brand": brand.Name})
+		}
+
+		if cardType != "" {
+			name, ok := t.Normalize(cardType)
+			if ok && name != brand.Name {
+				return validation.NewError(CodeMismatch, "belongs to {{.brand}}, not {{.type}}").SetParams(map[string]any{"brand": brand.Name, "type": name})
+			}
+		}
+
+		return nil
+	})
+}
+
+// CVVRule accepts CVVs with the length the brand of pan prints, four
+// digits on American Express and three on the others. Empty values pass,
+// as do all CVVs when the brand of pan is unknown, which NumberRule
+// reports.
+func (t Table) CVVRule(pan string) validation.Rule {
+	return validation.By(func(value any) error {
+		cvv, _ := value.(string)
+		if cvv == "" {
+			return nil
+		}
+
+		brand, ok := t.Detect(pan)
+		if !ok {
+			return nil
+		}
+		if !brand.ValidCVV(cvv) {
+			return validation.NewError(CodeCVV, "must be {{.length}} digits for {{.brand}}").SetParams(map[string]any{"brand": brand.Name, "length": brand.CVVLength})
+		}
+
+		return nil
+	})
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// luhn reports whether the check digit of pan is right.
+func luhn(pan string) bool {
+	var sum int
+	double := false
+	for i := len(pan) - 1; i >= 0; i-- {
+		d := int(pan[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,250 @@
+package cardbrand
+
+import (
+	"errors"
+	"kazokku/internal/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+func builtIn(t *testing.T) Table {
+	t.Helper()
+	table, err := New(utils.Card{})
+	if err != nil {
+		t.Fatalf("loading built-in ranges: %v", err)
+	}
+	return table
+}
+
+func TestDetect(t *testing.T) {
+	table := builtIn(t)
+
+	tests := []struct {
+		pan   string
+		brand string
+	}{
+		{"4000000000000002", "visa"},
+		{"5500000000000004", "mastercard"},
+		{"2221000000000009", "mastercard"},
+		{"2720000000000005", "mastercard"},
+		{"370000000000002", "amex"},
+		{"6011000000000004", "discover"},
+		{"6440000000000005", "discover"},
+		{"6500000000000002", "discover"},
+		{"3530000000000003", "jcb"},
+		{"6200000000000000000", "unionpay"},
+		{"675900000000", "maestro"},
+		{"5018000000000009", "maestro"},
+		{"30000000000004", "diners"},
+		{"30950000000000", "diners"},
+		{"36000000000008", "diners"},
+		// the longer co-brand prefix wins over UnionPay's 62
+		{"6221260000000000", "discover"},
+		{"6229250000000003", "discover"},
+		{"6229260000000002", "unionpay"},
+		{"6221250000000000", "unionpay"},
+		{"9000000000000001", ""},
+		{"6", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		brand, ok := table.Detect(tt.pan)
+		if ok != (tt.brand != "") || brand.Name != tt.brand {
+			t.Errorf("Detect(%q) = %q, %v; want %q", tt.pan, brand.Name, ok, tt.brand)
+		}
+	}
+}
+
+func TestValidNumber(t *testing.T) {
+	table := builtIn(t)
+
+	tests := []struct {
+		pan   string
+		valid bool
+	}{
+		{"4000000000006", true},
+		{"4000000000000002", true},
+		{"4000000000000000006", true},
+		{"400000000000006", false},
+		{"4000000000000003", false},
+		{"370000000000002", true},
+		{"3700000000000007", false},
+		{"675900000000", true},
+		{"6759000000000000005", true},
+		{"36000000000008", true},
+		{"4000-0000-0000-0002", false},
+	}
+	for _, tt := range tests {
+		brand, ok := table.Detect(tt.pan)
+		if !ok {
+			t.Fatalf("Detect(%q) found no brand", tt.pan)
+		}
+		if got := brand.ValidNumber(tt.pan); got != tt.valid {
+			t.Errorf("%s.ValidNumber(%q) = %v; want %v", brand.Name, tt.pan, got, tt.valid)
+		}
+	}
+}
+
+func TestValidCVV(t *testing.T) {
+	table := builtIn(t)
+
+	tests := []struct {
+		pan   string
+		cvv   string
+		valid bool
+	}{
+		{"370000000000002", "1234", true},
+		{"370000000000002", "123", false},
+		{"4000000000000002", "123", true},
+		{"4000000000000002", "1234", false},
+		{"4000000000000002", "12a", false},
+		{"4000000000000002", "", false},
+	}
+	for _, tt := range tests {
+		brand, _ := table.Detect(tt.pan)
+		if got := brand.ValidCVV(tt.cvv); got != tt.valid {
+			t.Errorf("%s.ValidCVV(%q) = %v; want %v", brand.Name, tt.cvv, got, tt.valid)
+		}
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		pan   string
+		valid bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"378282246310006", false},
+		{"0", true},
+		{"18", true},
+		{"19", false},
+	}
+	for _, tt := range tests {
+		if got := luhn(tt.pan); got != tt.valid {
+			t.Errorf("luhn(%q) = %v; want %v", tt.pan, got, tt.valid)
+		}
+	}
+}
+
+func TestParseLengths(t *testing.T) {
+	tests := []struct {
+		in      string
+		lengths []int
+	}{
+		{"16", []int{16}},
+		{"13|16|19", []int{13, 16, 19}},
+		{"16-19", []int{16, 17, 18, 19}},
+		{"14|16-17", []int{14, 16, 17}},
+		{" 15 ", []int{15}},
+	}
+	for _, tt := range tests {
+		lengths, err := parseLengths(tt.in)
+		if err != nil || !slices.Equal(lengths, tt.lengths) {
+			t.Errorf("parseLengths(%q) = %v, %v; want %v", tt.in, lengths, err, tt.lengths)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "11", "20", "19-16", "16-", "-16", "16||19"} {
+		if _, err := parseLengths(in); err == nil {
+			t.Errorf("parseLengths(%q) succeeded; want an error", in)
+		}
+	}
+}
+
+func TestNewBINFile(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "bins.csv")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("replaces built-in ranges", func(t *testing.T) {
+		table, err := New(utils.Card{BINFile: write(t, "# brand,start,end,lengths,cvv\namex,34,34,15,4\namex,37,37,15,4\n")})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if brand, ok := table.Detect("370000000000002"); !ok || brand.Name != "amex" || brand.CVVLength != 4 {
+			t.Errorf("Detect(amex) = %+v, %v", brand, ok)
+		}
+		if _, ok := table.Detect("4000000000000002"); ok {
+			t.Error("visa is detected although the file leaves it out")
+		}
+	})
+
+	malformed := map[string]string{
+		"too few fields":      "visa,4,4,16\n",
+		"too many fields":     "visa,4,4,16,3,x\n",
+		"no brand":            ",4,4,16,3\n",
+		"empty range":         "visa,,,16,3\n",
+		"reversed range":      "visa,55,51,16,3\n",
+		"uneven range":        "visa,4,40,16,3\n",
+		"non-numeric range":   "visa,4a,4b,16,3\n",
+		"bad lengths":         "visa,4,4,sixteen,3\n",
+		"length out of range": "visa,4,4,11-16,3\n",
+		"bad cvv length":      "visa,4,4,16,5\n",
+		"only comments":       "# nothing here\n",
+		"unterminated quote":  "\"visa,4,4,16,3\n",
+	}
+	for name, content := range malformed {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(utils.Card{BINFile: write(t, content)}); err == nil {
+				t.Errorf("New succeeded on %q; want an error", content)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := New(utils.Card{BINFile: filepath.Join(t.TempDir(), "missing.csv")}); err == nil {
+			t.Error("New succeeded on a missing file; want an error")
+		}
+	})
+}
+
+func TestRules(t *testing.T) {
+	table := builtIn(t)
+
+	code := func(err error) string {
+		var ruleErr validation.Error
+		if errors.As(err, &ruleErr) {
+			return ruleErr.Code()
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name string
+		rule validation.Rule
+		in   string
+		code string
+	}{
+		{"type known", table.TypeRule(), "Visa", ""},
+		{"type alias", table.TypeRule(), "American Express", ""},
+		{"type unknown", table.TypeRule(), "foo", CodeUnknown},
+		{"type empty", table.TypeRule(), "", ""},
+		{"number inferred", table.NumberRule(""), "4000000000000002", ""},
+		{"number matches alias", table.NumberRule("american express"), "370000000000002", ""},
+		{"number mismatch", table.NumberRule("amex"), "4000000000000002", CodeMismatch},
+		{"number bad check digit", table.NumberRule(""), "4000000000000003", CodeInvalid},
+		{"number unknown brand", table.NumberRule(""), "9000000000000001", CodeUnknown},
+		{"number wrong length", table.NumberRule(""), "400000000000006", CodeLength},
+		{"cvv amex 4 digits", table.CVVRule("370000000000002"), "1234", ""},
+		{"cvv amex 3 digits", table.CVVRule("370000000000002"), "123", CodeCVV},
+		{"cvv visa 4 digits", table.CVVRule("4000000000000002"), "1234", CodeCVV},
+		{"cvv unknown brand", table.CVVRule("9000000000000001"), "12", ""},
+	}
+	for _, tt := range tests {
+		err := tt.rule.Validate(tt.in)
+		if got := code(err); got != tt.code || (tt.code == "" && err != nil) {
+			t.Errorf("%s: Validate(%q) = %v; want code %q", tt.name, tt.in, err, tt.code)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package envelope
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"kazokku/internal/domain"
+	"kazokku/internal/utils"
+	"os"
+	"strings"
+)
+
+// Keyring encrypts records with AES-256-GCM under a fresh data key each,
+// and wraps that data key with a master key. New records are sealed under
+// the current master key, the others are kept to open records sealed
+// before a rotation.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// New loads the master keys from CARD_MASTER_KEY_FILE, one "id:base64 key"
+// per line, and from CARD_MASTER_KEY, which is registered under
+// CARD_MASTER_KEY_ID. The current key is CARD_MASTER_KEY_ID, or the last one
+// in the file when unset.
+func New(conf utils.Card) (Keyring, error) {
+	k := Keyring{current: conf.MasterKeyID, keys: make(map[string]cipher.AEAD)}
+
+	if conf.MasterKeyFile != "" {
+		data, err := os.ReadFile(conf.MasterKeyFile)
+		if err != nil {
+			return k, err
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		var last string
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			id, key, ok := strings.Cut(line, ":")
+			if !ok {
+				return k, fmt.Errorf("CARD_MASTER_KEY_FILE: line %q is not id:key", line)
+			}
+			if err := k.add(strings.TrimSpace(id), strings.TrimSpace(key)); err != nil {
+				return k, fmt.Errorf("CARD_MASTER_KEY_FILE: %w", err)
+			}
+			last = strings.TrimSpace(id)
+		}
+		if k.current == "" {
+			k.current = last
+		}
+	}
+
+	if conf.MasterKey != "" {
+		if conf.MasterKeyID == "" {
+			return k, errors.New("CARD_MASTER_KEY_ID is required with CARD_MASTER_KEY")
+		}
+		if err := k.add(conf.MasterKeyID, conf.MasterKey); err != nil {
+			return k, fmt.Errorf("CARD_MASTER_KEY: %w", err)
+		}
+	}
+
+	if _, ok := k.keys[k.current]; !ok {
+		return k, fmt.Errorf("card master key %q is not configured", k.current)
+	}
+
+	return k, nil
+}
+
+func (k Keyring) add(id, encoded string) error {
+	if id == "" || len(id) > 50 {
+		return errors.New("key id must be 1 to 50 characters")
+	}
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("key %q is defined twice", id)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("key %q is not valid base64: %w", id, err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", id, err)
+	}
+	k.keys[id] = aead
+
+	return nil
+}
+
+// CurrentKeyID is the id of the master key new records are sealed under.
+func (k Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+// Seal encrypts plaintext under a new data key. additionalData is
+// authenticated along with it, so a record copied elsewhere does not open.
+func (k Keyring) Seal(plaintext, additionalData []byte) (domain.Envelope, error) {
+	var env domain.Envelope
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return env, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return env, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return env, err
+	}
+
+	master := k.keys[k.current]
+	wrapNonce := make([]byte, master.NonceSize())
+	if _, err := rand.Read(wrapNonce); err != nil {
+		return env, err
+	}
+
+	env.KeyID = k.current
+	env.DataKey = master.Seal(wrapNonce, wrapNonce, dataKey, additionalData)
+	env.Nonce = nonce
+	env.Ciphertext = aead.Seal(nil, nonce, plaintext, additionalData)
+
+	return env, nil
+}
+
+// Open unwraps the data key of env with the master key it names and
+// decrypts the record.
+func (k Keyring) Open(env domain.Envelope, additionalData []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(env, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, env.Nonce, env.Ciphertext, additionalData)
+}
+
+func (k Keyring) unwrap(env domain.Envelope, additionalData []byte) ([]byte, error) {
+	master, ok := k.keys[env.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("card master key %q is not configured", env.KeyID)
+	}
+
+	if len(env.DataKey) < master.NonceSize() {
+		return nil, errors.New("wrapped data key too short")
+	}
+	wrapNonce, wrapped := env.DataKey[:master.NonceSize()], env.DataKey[master.NonceSize():]
+
+	return master.Open(nil, wrapNonce, wrapped, additionalData)
+}
+
+// Rewrap moves env to the current master key. Only the data key is
+// re-encrypted, the record itself is left as it is.
+func (k Keyring) Rewrap(env domain.Envelope, additionalData []byte) (domain.Envelope, error) {
+	dataKey, err := k.unwrap(env, additionalData)
+	if err != nil {
+		return env, err
+	}
+
+	master := k.keys[k.current]
+	wrapNonce := make([]byte, master.NonceSize())
+	if _, err := rand.Read(wrapNonce); err != nil {
+		return env, err
+	}
+
+	env.KeyID = k.current
+	env.DataKey = master.Seal(wrapNonce, wrapNonce, dataKey, additionalData)
+
+	return env, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
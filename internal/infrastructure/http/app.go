@@ -2,7 +2,16 @@ package http
 
 import (
 	"fmt"
+	"kazokku/internal/app/delivery/middleware"
 	"kazokku/internal/app/delivery/routes"
+	"kazokku/internal/app/repository"
+	"kazokku/internal/infrastructure/cardbrand"
+	"kazokku/internal/infrastructure/envelope"
+	"kazokku/internal/infrastructure/mail"
+	"kazokku/internal/infrastructure/password"
+	"kazokku/internal/infrastructure/ratelimit"
+	"kazokku/internal/infrastructure/token"
+	"kazokku/internal/infrastructure/totp"
 	"kazokku/internal/utils"
 	"log/slog"
 	"path/filepath"
@@ -20,21 +29,58 @@ type App struct {
 	port int
 }
 
-func New(conf utils.App, db *pgxpool.Pool, logger *slog.Logger) App {
+func New(conf utils.Config, db *pgxpool.Pool, limiter ratelimit.Limiter, keys envelope.Keyring, brands cardbrand.Table, logger *slog.Logger) (App, error) {
+	tokens, err := token.New(conf.JWT)
+	if err != nil {
+		return App{}, err
+	}
+
+	mailer, err := mail.New(conf.Mail)
+	if err != nil {
+		return App{}, err
+	}
+
+	hasher, err := password.New(conf.Password)
+	if err != nil {
+		return App{}, err
+	}
+
+	policy, err := password.NewPolicy(conf.Password)
+	if err != nil {
+		return App{}, err
+	}
+
+	otp, err := totp.New(conf.TOTP)
+	if err != nil {
+		return App{}, err
+	}
+
 	app := fiber.New()
 	app.Use(recover.New())
 	app.Use(loggerMW.New())
 	app.Use(requestid.New())
 
-	routes.NewUserRoutes(db, app, logger)
+	// shared so that rotating or revoking a key clears the one cache
+	apiKeyAuth := middleware.ApiKeyAuth{
+		Keys:       repository.NewCachedApiKeyRepository(repository.NewApiKeyRepository(db), conf.App.ApiKeyCacheTTL),
+		Nonces:     repository.NewNonceRepository(db),
+		HMACSecret: conf.App.ApiKeyHMACSecret,
+		MaxSkew:    conf.App.ApiKeyHMACMaxSkew,
+	}
+
+	routes.NewUserRoutes(conf, tokens, mailer, hasher, policy, keys, brands, apiKeyAuth, limiter, db, app, logger)
+	routes.NewCreditCardRoutes(tokens, keys, brands, apiKeyAuth, limiter, db, app, logger)
+	routes.NewAuthRoutes(conf, tokens, mailer, hasher, policy, otp, limiter, db, app, logger)
+	routes.NewAdminRoutes(conf, apiKeyAuth, otp, limiter, db, app, logger)
+	routes.NewAuditRoutes(apiKeyAuth, limiter, db, app, logger)
 
-	app.Static("/photos", filepath.Join(conf.SaveDir, "photos"))
+	app.Static("/photos", filepath.Join(conf.App.SaveDir, "photos"))
 
 	return App{
 		app:  app,
-		host: conf.Host,
-		port: conf.Port,
-	}
+		host: conf.App.Host,
+		port: conf.App.Port,
+	}, nil
 }
 
 func (a App) Run() error {
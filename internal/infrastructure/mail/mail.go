@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"kazokku/internal/utils"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails such as password reset tokens.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func New(conf utils.Mail) (Mailer, error) {
+	switch conf.Driver {
+	case "smtp":
+		return NewSMTPMailer(conf), nil
+	case "memory":
+		return NewInMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", conf.Driver)
+	}
+}
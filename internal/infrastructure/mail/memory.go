@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// InMemoryMailer keeps sent messages in memory instead of delivering them.
+type InMemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewInMemoryMailer() *InMemoryMailer {
+	return &InMemoryMailer{}
+}
+
+func (m *InMemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+
+	return nil
+}
+
+// Messages returns a copy of every message sent so far.
+func (m *InMemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"kazokku/internal/utils"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer sends mail through an SMTP relay. Authentication is skipped
+// when no username is configured, which is what local stand-ins such as
+// MailHog expect.
+func NewSMTPMailer(conf utils.Mail) SMTPMailer {
+	m := SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+		from: conf.From,
+	}
+	if conf.Username != "" {
+		m.auth = smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)
+	}
+
+	return m
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("From: %s\r\n", m.from))
+	body.WriteString(fmt.Sprintf("To: %s\r\n", msg.To))
+	body.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(msg.Body)
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(body.String()))
+}
@@ -0,0 +1,9 @@
+package password
+
+import "golang.org/x/crypto/bcrypt"
+
+// verifyBcrypt checks hashes created before argon2id was introduced. New
+// bcrypt hashes are never created.
+func verifyBcrypt(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,63 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedCorpus looks passwords up in a local copy of the Have I Been Pwned
+// range API: a directory holding one file per five character SHA-1 prefix,
+// named after the prefix with an optional .txt extension, with one
+// "SUFFIX:COUNT" line per breached hash. Only the file of the prefix is read,
+// so the corpus never has to fit in memory and no request leaves the host.
+type BreachedCorpus struct {
+	dir string
+}
+
+func NewBreachedCorpus(dir string) (BreachedCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return BreachedCorpus{}, fmt.Errorf("breached password corpus: %w", err)
+	}
+	if !info.IsDir() {
+		return BreachedCorpus{}, fmt.Errorf("breached password corpus: %s is not a directory", dir)
+	}
+
+	return BreachedCorpus{dir}, nil
+}
+
+// Contains reports whether the SHA-1 of password is listed in the corpus.
+func (c BreachedCorpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = os.Open(filepath.Join(c.dir, prefix))
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,76 @@
+package password
+
+import (
+	"errors"
+	"kazokku/internal/helpers"
+	"kazokku/internal/utils"
+	"strings"
+)
+
+// Hasher hashes passwords into a self-describing format and verifies them
+// against every format it understands.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, and whether hash should
+	// be replaced with a fresh Hash because its scheme or parameters are
+	// outdated.
+	Verify(hash, password string) (ok, rehash bool)
+	// DummyHash returns a valid hash to verify against when there is no
+	// stored hash, so failed lookups cost as much as failed checks.
+	DummyHash() string
+}
+
+// hasher hashes with argon2id and still verifies legacy bcrypt hashes.
+type hasher struct {
+	argon2id argon2idParams
+	dummy    string
+}
+
+func New(conf utils.Password) (Hasher, error) {
+	// argon2 panics on zero iterations or parallelism
+	if conf.Argon2Memory < 1 || conf.Argon2Iterations < 1 || conf.Argon2Parallelism < 1 {
+		return nil, errors.New("PASSWORD_ARGON2_MEMORY, PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM must be at least 1")
+	}
+
+	h := hasher{
+		argon2id: argon2idParams{
+			Memory:      conf.Argon2Memory,
+			Iterations:  conf.Argon2Iterations,
+			Parallelism: conf.Argon2Parallelism,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+
+	random, err := helpers.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if h.dummy, err = h.Hash(random); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h hasher) Hash(password string) (string, error) {
+	return hashArgon2id(h.argon2id, password)
+}
+
+func (h hasher) Verify(hash, password string) (bool, bool) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, ok := verifyArgon2id(hash, password)
+		return ok, ok && params != h.argon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		ok := verifyBcrypt(hash, password)
+		return ok, ok
+	default:
+		return false, false
+	}
+}
+
+func (h hasher) DummyHash() string {
+	return h.dummy
+}
@@ -0,0 +1,115 @@
+package password
+
+import (
+	"kazokku/internal/utils"
+	"strings"
+	"unicode/utf8"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// Codes of the errors a policy returns. They share the validation_password_
+// prefix, which tells ValidationError to show their message to the client.
+const (
+	CodeTooShort = "validation_password_too_short"
+	CodeTooLong  = "validation_password_too_long"
+	CodePersonal = "validation_password_personal"
+	CodeWeak     = "validation_password_weak"
+	CodeBreached = "validation_password_breached"
+)
+
+// Policy decides whether a new password is acceptable.
+type Policy struct {
+	minLength int
+	maxLength int
+	minScore  int
+	breached  *BreachedCorpus
+}
+
+func NewPolicy(conf utils.Password) (Policy, error) {
+	p := Policy{
+		minLength: conf.MinLength,
+		maxLength: conf.MaxLength,
+		minScore:  conf.MinScore,
+	}
+
+	if conf.BreachedCorpusDir != "" {
+		corpus, err := NewBreachedCorpus(conf.BreachedCorpusDir)
+		if err != nil {
+			return p, err
+		}
+		p.breached = &corpus
+	}
+
+	return p, nil
+}
+
+// Check returns a validation error explaining why password is rejected, or
+// nil. inputs are personal details such as the name and email, which the
+// password must not contain and which count against its strength.
+func (p Policy) Check(password string, inputs ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return validation.NewError(CodeTooShort, "must be at least {{.min}} characters long").SetParams(map[string]any{"min": p.minLength})
+	}
+	// the strength estimate gets slow on very long input
+	if length > p.maxLength {
+		return validation.NewError(CodeTooLong, "must be at most {{.max}} characters long").SetParams(map[string]any{"max": p.maxLength})
+	}
+
+	words := personalWords(inputs)
+	lower := strings.ToLower(password)
+	for _, word := range words {
+		if strings.Contains(lower, word) {
+			return validation.NewError(CodePersonal, "must not contain your name or email")
+		}
+	}
+
+	if zxcvbn.PasswordStrength(password, words).Score < p.minScore {
+		return validation.NewError(CodeWeak, "is too easy to guess, try a longer phrase of unrelated words")
+	}
+
+	if p.breached != nil {
+		found, err := p.breached.Contains(password)
+		if err != nil {
+			return validation.NewInternalError(err)
+		}
+		if found {
+			return validation.NewError(CodeBreached, "has appeared in a data breach, please choose another one")
+		}
+	}
+
+	return nil
+}
+
+// Rule returns Check as a validation rule. Empty values pass, leaving it to
+// validation.Required whether a password must be given.
+func (p Policy) Rule(inputs ...string) validation.Rule {
+	return validation.By(func(value any) error {
+		password, _ := value.(string)
+		if password == "" {
+			return nil
+		}
+		return p.Check(password, inputs...)
+	})
+}
+
+// personalWords splits inputs into the lowercase words a password must not
+// contain. Words shorter than three letters match too much to be useful.
+func personalWords(inputs []string) []string {
+	var words []string
+	for _, input := range inputs {
+		input = strings.ToLower(input)
+		fields := strings.FieldsFunc(input, func(r rune) bool {
+			return r == ' ' || r == '@' || r == '.' || r == '-' || r == '_' || r == '+'
+		})
+		for _, field := range fields {
+			if utf8.RuneCountInString(field) >= 3 {
+				words = append(words, field)
+			}
+		}
+	}
+
+	return words
+}
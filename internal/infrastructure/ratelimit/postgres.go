@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so that every
+// instance sharing the database enforces the same limits. Bucket timestamps
+// come from the database clock, keeping replicas with skewed clocks
+// consistent.
+type PostgresStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresStore(db *pgxpool.Pool) PostgresStore {
+	return PostgresStore{db}
+}
+
+func (s PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	stmt := "INSERT INTO rate_limit_buckets(key, tokens, updated_at) VALUES ($1, $2, NOW()) ON CONFLICT DO NOTHING;"
+	if _, err = tx.Exec(ctx, stmt, key, limit.Requests); err != nil {
+		return Result{}, err
+	}
+
+	// lock the bucket so concurrent requests take tokens one after another
+	var b bucket
+	var now time.Time
+	stmt = "SELECT tokens, updated_at, NOW() FROM rate_limit_buckets WHERE key = $1 FOR UPDATE;"
+	if err = tx.QueryRow(ctx, stmt, key).Scan(&b.tokens, &b.updatedAt, &now); err != nil {
+		return Result{}, err
+	}
+
+	result := b.take(limit, now)
+
+	stmt = "UPDATE rate_limit_buckets SET tokens = $1, updated_at = $2 WHERE key = $3;"
+	if _, err = tx.Exec(ctx, stmt, b.tokens, b.updatedAt, key); err != nil {
+		return Result{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+func (s PostgresStore) DeleteIdle(ctx context.Context, idle time.Duration) error {
+	stmt := "DELETE FROM rate_limit_buckets WHERE updated_at < NOW() - make_interval(secs => $1);"
+
+	_, err := s.db.Exec(ctx, stmt, idle.Seconds())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
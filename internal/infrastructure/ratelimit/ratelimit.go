@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"kazokku/internal/utils"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Limit allows Requests per Period. Buckets hold up to Requests tokens and
+// refill continuously, so short bursts are allowed up to the full limit.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// ParseLimit parses limits written as "10/1m". An empty value or "off"
+// disables limiting.
+func ParseLimit(s string) (Limit, bool, error) {
+	if s == "" || s == "off" {
+		return Limit{}, false, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, false, fmt.Errorf("invalid rate limit %q", s)
+	}
+
+	var limit Limit
+	var err error
+	if limit.Requests, err = strconv.Atoi(requests); err != nil || limit.Requests < 1 {
+		return Limit{}, false, fmt.Errorf("invalid rate limit %q", s)
+	}
+
+	if limit.Period, err = time.ParseDuration(period); err != nil || limit.Period <= 0 {
+		return Limit{}, false, fmt.Errorf("invalid rate limit %q", s)
+	}
+
+	return limit, true, nil
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Take removes a token from the bucket named key
+// if one is available.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// DeleteIdle drops buckets untouched for longer than idle; they would be
+	// full again and are indistinguishable from new ones.
+	DeleteIdle(ctx context.Context, idle time.Duration) error
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take refills b for the time passed since its last update and consumes a
+// token when at least one is available.
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	capacity := float64(limit.Requests)
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*limit.rate())
+	b.updatedAt = now
+
+	result := Result{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / limit.rate() * float64(time.Second))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) / limit.rate() * float64(time.Second))
+
+	return result
+}
+
+// Limiter applies the configured limit of a route to a bucket key.
+type Limiter struct {
+	store    Store
+	fallback Limit
+	hasLimit bool
+	routes   map[string]Limit
+	disabled map[string]bool
+	logger   *slog.Logger
+}
+
+func New(conf utils.RateLimit, db *pgxpool.Pool, logger *slog.Logger) (Limiter, error) {
+	limiter := Limiter{
+		routes:   make(map[string]Limit),
+		disabled: make(map[string]bool),
+		logger:   logger,
+	}
+
+	switch conf.Store {
+	case "memory":
+		limiter.store = NewMemoryStore()
+	case "postgres":
+		limiter.store = NewPostgresStore(db)
+	default:
+		return limiter, fmt.Errorf("unsupported rate limit store %q", conf.Store)
+	}
+
+	var err error
+	if limiter.fallback, limiter.hasLimit, err = ParseLimit(conf.Default); err != nil {
+		return limiter, err
+	}
+
+	// routes are configured as "register=10/1m,login=off"
+	for _, route := range strings.Split(conf.Routes, ",") {
+		if route = strings.TrimSpace(route); route == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(route, "=")
+		if !ok {
+			return limiter, fmt.Errorf("invalid route rate limit %q", route)
+		}
+
+		limit, enabled, err := ParseLimit(value)
+		if err != nil {
+			return limiter, err
+		}
+		if enabled {
+			limiter.routes[name] = limit
+		} else {
+			limiter.disabled[name] = true
+		}
+	}
+
+	return limiter, nil
+}
+
+func (l Limiter) limit(route string) (Limit, bool) {
+	if limit, ok := l.routes[route]; ok {
+		return limit, true
+	}
+
+	return l.fallback, l.hasLimit && !l.disabled[route]
+}
+
+// Take consumes a token of the route's bucket for key. It reports false when
+// the route is not limited. Store failures are logged and let the request
+// through, so an unavailable store does not take the API down.
+func (l Limiter) Take(ctx context.Context, route, key string) (Result, bool) {
+	limit, ok := l.limit(route)
+	if !ok {
+		return Result{}, false
+	}
+
+	result, err := l.store.Take(ctx, route+":"+key, limit)
+	if err != nil {
+		l.logger.ErrorContext(ctx, "error taking rate limit token", "error", err, "route", route)
+		return Result{}, false
+	}
+
+	return result, true
+}
+
+// Run drops idle buckets once per longest period until ctx is done.
+func (l Limiter) Run(ctx context.Context) {
+	idle := l.fallback.Period
+	for _, limit := range l.routes {
+		idle = max(idle, limit.Period)
+	}
+
+	if idle <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(idle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.store.DeleteIdle(ctx, idle); err != nil {
+			l.logger.ErrorContext(ctx, "error deleting idle rate limit buckets", "error", err)
+		}
+	}
+}
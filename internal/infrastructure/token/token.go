@@ -0,0 +1,162 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"kazokku/internal/utils"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID uint `json:"sid"`
+}
+
+// UserID returns the id of the user the token was issued to.
+func (c Claims) UserID() uint {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return uint(id)
+}
+
+// Manager issues and verifies signed access tokens.
+type Manager struct {
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	issuer    string
+	ttl       time.Duration
+}
+
+func New(conf utils.JWT) (Manager, error) {
+	m := Manager{
+		issuer: conf.Issuer,
+		ttl:    conf.AccessTokenTTL,
+	}
+
+	switch conf.Algorithm {
+	case "HS256":
+		if conf.Secret == "" {
+			return m, errors.New("JWT_SECRET is required for HS256")
+		}
+		m.method = jwt.SigningMethodHS256
+		m.signKey = []byte(conf.Secret)
+		m.verifyKey = []byte(conf.Secret)
+	case "EdDSA":
+		privateKey, err := loadEd25519PrivateKey(conf.PrivateKeyFile)
+		if err != nil {
+			return m, err
+		}
+		publicKey := privateKey.Public().(ed25519.PublicKey)
+		if conf.PublicKeyFile != "" {
+			publicKey, err = loadEd25519PublicKey(conf.PublicKeyFile)
+			if err != nil {
+				return m, err
+			}
+		}
+		m.method = jwt.SigningMethodEdDSA
+		m.signKey = privateKey
+		m.verifyKey = publicKey
+	default:
+		return m, fmt.Errorf("unsupported JWT algorithm %q", conf.Algorithm)
+	}
+
+	return m, nil
+}
+
+// Issue returns a signed access token for userID bound to sessionID and its
+// expiry time.
+func (m Manager) Issue(userID, sessionID uint) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		SessionID: sessionID,
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", expiresAt, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+// Parse verifies the signature, issuer and expiry of a token and returns its
+// claims.
+func (m Manager) Parse(tokenString string) (Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
+		return m.verifyKey, nil
+	}, jwt.WithValidMethods([]string{m.method.Alg()}), jwt.WithIssuer(m.issuer), jwt.WithExpirationRequired())
+	if err != nil || claims.UserID() == 0 || claims.SessionID == 0 {
+		return claims, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func loadEd25519PrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 private key", path)
+	}
+
+	return privateKey, nil
+}
+
+func loadEd25519PublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 public key", path)
+	}
+
+	return publicKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM block", path)
+	}
+
+	return block, nil
+}
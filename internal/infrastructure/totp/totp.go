@@ -0,0 +1,174 @@
+package totp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"kazokku/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	period = 30
+	digits = otp.DigitsSix
+	// skew is the number of steps either side of the current one that are
+	// still accepted, to allow for clock drift on the device.
+	skew = 1
+)
+
+// Key is a freshly generated TOTP secret together with the ways to show it
+// to the user.
+type Key struct {
+	Secret string
+	URI    string
+	QRCode []byte
+}
+
+// Manager generates and validates RFC 6238 codes, and encrypts secrets with
+// AES-256-GCM so a database dump does not reveal them.
+type Manager struct {
+	issuer string
+	aead   cipher.AEAD
+}
+
+func New(conf utils.TOTP) (Manager, error) {
+	m := Manager{issuer: conf.Issuer}
+
+	key, err := base64.StdEncoding.DecodeString(conf.EncryptionKey)
+	if err != nil {
+		return m, fmt.Errorf("TOTP_ENCRYPTION_KEY is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return m, errors.New("TOTP_ENCRYPTION_KEY must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return m, err
+	}
+	m.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
+
+// Generate returns a new secret for account, its otpauth:// URI and the URI
+// rendered as a QR code PNG.
+func (m Manager) Generate(account string) (Key, error) {
+	var k Key
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      m.issuer,
+		AccountName: account,
+		Period:      period,
+		Digits:      digits,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return k, err
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return k, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return k, err
+	}
+
+	k.Secret = key.Secret()
+	k.URI = key.URL()
+	k.QRCode = buf.Bytes()
+
+	return k, nil
+}
+
+// Validate checks code against secret and returns the time step it belongs
+// to. Steps up to and including lastStep are rejected, so a code cannot be
+// used twice.
+func (m Manager) Validate(secret, code string, lastStep int64) (int64, bool) {
+	current := time.Now().Unix() / period
+	for step := current - skew; step <= current+skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*period, 0), totp.ValidateOpts{
+			Period:    period,
+			Digits:    digits,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Seal encrypts the secret of userID. The user id is authenticated along
+// with it, so a ciphertext copied to another row does not decrypt.
+func (m Manager) Seal(userID uint, secret string) ([]byte, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return m.aead.Seal(nonce, nonce, []byte(secret), additionalData(userID)), nil
+}
+
+func (m Manager) Open(userID uint, sealed []byte) (string, error) {
+	if len(sealed) < m.aead.NonceSize() {
+		return "", errors.New("sealed totp secret too short")
+	}
+
+	nonce, ciphertext := sealed[:m.aead.NonceSize()], sealed[m.aead.NonceSize():]
+	secret, err := m.aead.Open(nil, nonce, ciphertext, additionalData(userID))
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+// GenerateRecoveryCodes returns n random codes of 16 base32 characters,
+// grouped by four for readability.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode strips the formatting users tend to vary, so the code
+// hashes the same however it was typed.
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func additionalData(userID uint) []byte {
+	return []byte("user:" + strconv.FormatUint(uint64(userID), 10))
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -16,20 +18,115 @@ type DB struct {
 }
 
 type App struct {
-	Host    string `mapstructure:"APP_HOST"`
-	Port    int    `mapstructure:"APP_PORT"`
-	SaveDir string `mapstructure:"SAVE_DIR"`
+	Host               string        `mapstructure:"APP_HOST"`
+	Port               int           `mapstructure:"APP_PORT"`
+	SaveDir            string        `mapstructure:"SAVE_DIR"`
+	RequireIfMatch     bool          `mapstructure:"REQUIRE_IF_MATCH"`
+	ApiKeyCacheTTL     time.Duration `mapstructure:"API_KEY_CACHE_TTL"`
+	ApiKeyHMACSecret   string        `mapstructure:"API_KEY_HMAC_SECRET"`
+	ApiKeyHMACMaxSkew  time.Duration `mapstructure:"API_KEY_HMAC_MAX_SKEW"`
+	ApiKeyLegacy       string        `mapstructure:"API_KEY_LEGACY"`
+	NoncePurgeInterval time.Duration `mapstructure:"API_KEY_NONCE_PURGE_INTERVAL"`
+}
+
+type JWT struct {
+	Algorithm      string        `mapstructure:"JWT_ALGORITHM"`
+	Secret         string        `mapstructure:"JWT_SECRET"`
+	PrivateKeyFile string        `mapstructure:"JWT_PRIVATE_KEY_FILE"`
+	PublicKeyFile  string        `mapstructure:"JWT_PUBLIC_KEY_FILE"`
+	Issuer         string        `mapstructure:"JWT_ISSUER"`
+	AccessTokenTTL time.Duration `mapstructure:"JWT_ACCESS_TTL"`
+	SessionTTL     time.Duration `mapstructure:"SESSION_TTL"`
+}
+
+type Mail struct {
+	Driver   string `mapstructure:"MAIL_DRIVER"`
+	Host     string `mapstructure:"SMTP_HOST"`
+	Port     int    `mapstructure:"SMTP_PORT"`
+	Username string `mapstructure:"SMTP_USERNAME"`
+	Password string `mapstructure:"SMTP_PASSWORD"`
+	From     string `mapstructure:"MAIL_FROM"`
+}
+
+type Password struct {
+	Argon2Memory      uint32 `mapstructure:"PASSWORD_ARGON2_MEMORY"`
+	Argon2Iterations  uint32 `mapstructure:"PASSWORD_ARGON2_ITERATIONS"`
+	Argon2Parallelism uint8  `mapstructure:"PASSWORD_ARGON2_PARALLELISM"`
+	MinLength         int    `mapstructure:"PASSWORD_MIN_LENGTH"`
+	MaxLength         int    `mapstructure:"PASSWORD_MAX_LENGTH"`
+	MinScore          int    `mapstructure:"PASSWORD_MIN_SCORE"`
+	BreachedCorpusDir string `mapstructure:"PASSWORD_BREACHED_CORPUS_DIR"`
+}
+
+type Account struct {
+	PasswordResetTTL        time.Duration `mapstructure:"PASSWORD_RESET_TTL"`
+	EmailVerificationTTL    time.Duration `mapstructure:"EMAIL_VERIFICATION_TTL"`
+	LoginFailureWindow      time.Duration `mapstructure:"LOGIN_FAILURE_WINDOW"`
+	LoginDelayBase          time.Duration `mapstructure:"LOGIN_DELAY_BASE"`
+	LoginDelayMax           time.Duration `mapstructure:"LOGIN_DELAY_MAX"`
+	LoginLockoutThreshold   uint          `mapstructure:"LOGIN_LOCKOUT_THRESHOLD"`
+	LoginLockoutDuration    time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginIPLockoutThreshold uint          `mapstructure:"LOGIN_IP_LOCKOUT_THRESHOLD"`
+}
+
+type TOTP struct {
+	Issuer                 string        `mapstructure:"TOTP_ISSUER"`
+	EncryptionKey          string        `mapstructure:"TOTP_ENCRYPTION_KEY"`
+	ChallengeTTL           time.Duration `mapstructure:"TOTP_CHALLENGE_TTL"`
+	RecoveryCodes          int           `mapstructure:"TOTP_RECOVERY_CODES"`
+	RequiredForCardholders bool          `mapstructure:"TOTP_REQUIRED_FOR_CARDHOLDERS"`
+}
+
+type RateLimit struct {
+	Store   string `mapstructure:"RATE_LIMIT_STORE"`
+	Default string `mapstructure:"RATE_LIMIT_DEFAULT"`
+	Routes  string `mapstructure:"RATE_LIMIT_ROUTES"`
+}
+
+type Purge struct {
+	Retention time.Duration `mapstructure:"PURGE_RETENTION"`
+	Interval  time.Duration `mapstructure:"PURGE_INTERVAL"`
+}
+
+type Card struct {
+	MasterKey     string `mapstructure:"CARD_MASTER_KEY"`
+	MasterKeyID   string `mapstructure:"CARD_MASTER_KEY_ID"`
+	MasterKeyFile string `mapstructure:"CARD_MASTER_KEY_FILE"`
+	BINFile       string `mapstructure:"CARD_BIN_FILE"`
+}
+
+type Audit struct {
+	StreamFile     string        `mapstructure:"AUDIT_STREAM_FILE"`
+	StreamInterval time.Duration `mapstructure:"AUDIT_STREAM_INTERVAL"`
 }
 
 type Config struct {
-	Database DB
-	App      App
+	Database  DB
+	App       App
+	Purge     Purge
+	JWT       JWT
+	Mail      Mail
+	Account   Account
+	Password  Password
+	TOTP      TOTP
+	Card      Card
+	RateLimit RateLimit
+	Audit     Audit
 }
 
 func LoadConfig(configFilePath string) (Config, error) {
 	var conf Config
 	var dbConf DB
 	var appConf App
+	var purgeConf Purge
+	var jwtConf JWT
+	var mailConf Mail
+	var accountConf Account
+	var passwordConf Password
+	var totpConf TOTP
+	var cardConf Card
+	var rateLimitConf RateLimit
+	var auditConf Audit
 
 	_, err := os.Stat(configFilePath)
 	if err != nil {
@@ -40,6 +137,55 @@ func LoadConfig(configFilePath string) (Config, error) {
 
 	v.SetConfigFile(configFilePath)
 	v.AutomaticEnv()
+	v.SetDefault("API_KEY_CACHE_TTL", "1m")
+	v.SetDefault("API_KEY_HMAC_SECRET", "")
+	v.SetDefault("API_KEY_HMAC_MAX_SKEW", "5m")
+	v.SetDefault("API_KEY_LEGACY", "")
+	v.SetDefault("API_KEY_NONCE_PURGE_INTERVAL", "1m")
+	v.SetDefault("PURGE_RETENTION", "720h")
+	v.SetDefault("PURGE_INTERVAL", "1h")
+	v.SetDefault("JWT_ALGORITHM", "HS256")
+	v.SetDefault("JWT_SECRET", "")
+	v.SetDefault("JWT_PRIVATE_KEY_FILE", "")
+	v.SetDefault("JWT_PUBLIC_KEY_FILE", "")
+	v.SetDefault("JWT_ISSUER", "kazokku")
+	v.SetDefault("JWT_ACCESS_TTL", "15m")
+	v.SetDefault("SESSION_TTL", "720h")
+	v.SetDefault("MAIL_DRIVER", "smtp")
+	v.SetDefault("SMTP_HOST", "localhost")
+	v.SetDefault("SMTP_PORT", 1025)
+	v.SetDefault("SMTP_USERNAME", "")
+	v.SetDefault("SMTP_PASSWORD", "")
+	v.SetDefault("MAIL_FROM", "no-reply@kazokku.local")
+	v.SetDefault("PASSWORD_RESET_TTL", "30m")
+	v.SetDefault("EMAIL_VERIFICATION_TTL", "24h")
+	v.SetDefault("LOGIN_FAILURE_WINDOW", "15m")
+	v.SetDefault("LOGIN_DELAY_BASE", "1s")
+	v.SetDefault("LOGIN_DELAY_MAX", "30s")
+	v.SetDefault("LOGIN_LOCKOUT_THRESHOLD", 5)
+	v.SetDefault("LOGIN_LOCKOUT_DURATION", "15m")
+	v.SetDefault("LOGIN_IP_LOCKOUT_THRESHOLD", 50)
+	v.SetDefault("PASSWORD_ARGON2_MEMORY", 64*1024)
+	v.SetDefault("PASSWORD_ARGON2_ITERATIONS", 3)
+	v.SetDefault("PASSWORD_ARGON2_PARALLELISM", 2)
+	v.SetDefault("PASSWORD_MIN_LENGTH", 10)
+	v.SetDefault("PASSWORD_MAX_LENGTH", 128)
+	v.SetDefault("PASSWORD_MIN_SCORE", 3)
+	v.SetDefault("PASSWORD_BREACHED_CORPUS_DIR", "")
+	v.SetDefault("TOTP_ISSUER", "kazokku")
+	v.SetDefault("TOTP_ENCRYPTION_KEY", "")
+	v.SetDefault("TOTP_CHALLENGE_TTL", "5m")
+	v.SetDefault("TOTP_RECOVERY_CODES", 10)
+	v.SetDefault("TOTP_REQUIRED_FOR_CARDHOLDERS", true)
+	v.SetDefault("CARD_MASTER_KEY", "")
+	v.SetDefault("CARD_MASTER_KEY_ID", "")
+	v.SetDefault("CARD_MASTER_KEY_FILE", "")
+	v.SetDefault("CARD_BIN_FILE", "")
+	v.SetDefault("RATE_LIMIT_STORE", "memory")
+	v.SetDefault("RATE_LIMIT_DEFAULT", "300/1m")
+	v.SetDefault("RATE_LIMIT_ROUTES", "")
+	v.SetDefault("AUDIT_STREAM_FILE", "")
+	v.SetDefault("AUDIT_STREAM_INTERVAL", "10s")
 
 	if err := v.ReadInConfig(); err != nil {
 		return conf, err
@@ -53,8 +199,67 @@ func LoadConfig(configFilePath string) (Config, error) {
 		return conf, err
 	}
 
+	if appConf.ApiKeyHMACMaxSkew <= 0 {
+		return conf, errors.New("API_KEY_HMAC_MAX_SKEW must be positive")
+	}
+	if appConf.NoncePurgeInterval <= 0 {
+		return conf, errors.New("API_KEY_NONCE_PURGE_INTERVAL must be positive")
+	}
+
+	if err := v.Unmarshal(&purgeConf); err != nil {
+		return conf, err
+	}
+
+	if purgeConf.Retention < 0 {
+		return conf, errors.New("PURGE_RETENTION must not be negative")
+	}
+	if purgeConf.Interval <= 0 {
+		return conf, errors.New("PURGE_INTERVAL must be positive")
+	}
+
+	if err := v.Unmarshal(&jwtConf); err != nil {
+		return conf, err
+	}
+
+	if err := v.Unmarshal(&mailConf); err != nil {
+		return conf, err
+	}
+
+	if err := v.Unmarshal(&accountConf); err != nil {
+		return conf, err
+	}
+
+	if err := v.Unmarshal(&passwordConf); err != nil {
+		return conf, err
+	}
+
+	if err := v.Unmarshal(&totpConf); err != nil {
+		return conf, err
+	}
+
+	if err := v.Unmarshal(&cardConf); err != nil {
+		return conf, err
+	}
+
+	if err := v.Unmarshal(&rateLimitConf); err != nil {
+		return conf, err
+	}
+
+	if err := v.Unmarshal(&auditConf); err != nil {
+		return conf, err
+	}
+
 	conf.Database = dbConf
 	conf.App = appConf
+	conf.Purge = purgeConf
+	conf.JWT = jwtConf
+	conf.Mail = mailConf
+	conf.Account = accountConf
+	conf.Password = passwordConf
+	conf.TOTP = totpConf
+	conf.Card = cardConf
+	conf.RateLimit = rateLimitConf
+	conf.Audit = auditConf
 	os.Setenv("SAVE_DIR", appConf.SaveDir)
 
 	return conf, nil
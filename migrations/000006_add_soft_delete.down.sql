@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE photos DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+
+COMMIT;
\ No newline at end of file
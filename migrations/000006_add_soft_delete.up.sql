@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+
+ALTER TABLE credit_cards ADD COLUMN deleted_at TIMESTAMPTZ;
+
+ALTER TABLE photos ADD COLUMN deleted_at TIMESTAMPTZ;
+
+COMMIT;
\ No newline at end of file
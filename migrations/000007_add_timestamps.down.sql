@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE photos DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE photos DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    changes JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, version)
+);
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+UPDATE users u SET version = h.version + 1
+FROM (SELECT user_id, MAX(version) AS version FROM user_history GROUP BY user_id) h
+WHERE h.user_id = u.id;
+
+COMMIT;
\ No newline at end of file
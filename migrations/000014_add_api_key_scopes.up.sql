@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE api_keys ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
+
+-- existing keys could call every user route, keep those working; deleting
+-- users and managing keys has to be granted explicitly
+UPDATE api_keys SET scopes = ARRAY['users:read', 'users:write', 'users:register', 'cards:read_masked'] WHERE scopes = '{}';
+
+COMMIT;
\ No newline at end of file
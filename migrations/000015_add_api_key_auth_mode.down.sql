@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS request_nonces;
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS hmac_salt;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS auth_mode;
+
+COMMIT;
\ No newline at end of file
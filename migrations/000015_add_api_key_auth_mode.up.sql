@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE api_keys ADD COLUMN auth_mode VARCHAR(10) NOT NULL DEFAULT 'bearer' CHECK (auth_mode IN ('bearer', 'hmac'));
+ALTER TABLE api_keys ADD COLUMN hmac_salt VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS request_nonces (
+    api_key_id BIGINT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    nonce VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (api_key_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS request_nonces_expires_at_idx ON request_nonces(expires_at);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+UPDATE api_keys SET scopes = array_remove(scopes, 'users:admin');
+
+DROP TABLE IF EXISTS login_attempts;
+
+COMMIT;
\ No newline at end of file
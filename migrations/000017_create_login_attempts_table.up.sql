@@ -0,0 +1,13 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('account', 'ip')),
+    subject VARCHAR(250) NOT NULL,
+    failures INT NOT NULL,
+    last_failed_at TIMESTAMPTZ NOT NULL,
+    delayed_until TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (scope, subject)
+);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE api_keys ADD COLUMN role VARCHAR(10) CHECK (role IN ('admin', 'support', 'auditor'));
+
+-- existing keys keep their scopes without a role ceiling
+
+COMMIT;
\ No newline at end of file
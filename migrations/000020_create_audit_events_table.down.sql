@@ -0,0 +1,8 @@
+BEGIN;
+
+UPDATE api_keys SET scopes = array_remove(scopes, 'audit:read');
+
+DROP TABLE IF EXISTS audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+
+COMMIT;
\ No newline at end of file
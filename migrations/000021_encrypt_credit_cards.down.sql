@@ -0,0 +1,15 @@
+BEGIN;
+
+-- encrypted cards cannot be decrypted here, so this fails while any exist.
+-- CVVs are no longer kept at all, the column 000023 restores stays nullable.
+ALTER TABLE credit_cards ALTER COLUMN number SET NOT NULL;
+ALTER TABLE credit_cards ALTER COLUMN expired SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_credit_cards_plaintext;
+
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS ciphertext;
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS nonce;
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS data_key;
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS key_id;
+
+COMMIT;
\ No newline at end of file
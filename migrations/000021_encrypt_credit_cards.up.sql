@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE credit_cards ADD COLUMN key_id VARCHAR(50);
+ALTER TABLE credit_cards ADD COLUMN data_key BYTEA;
+ALTER TABLE credit_cards ADD COLUMN nonce BYTEA;
+ALTER TABLE credit_cards ADD COLUMN ciphertext BYTEA;
+
+-- number, expiry and CVV are cleared once a card is encrypted. Existing
+-- rows stay readable in plaintext until the application encrypts them.
+ALTER TABLE credit_cards ALTER COLUMN number DROP NOT NULL;
+ALTER TABLE credit_cards ALTER COLUMN expired DROP NOT NULL;
+ALTER TABLE credit_cards ALTER COLUMN cvv DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_credit_cards_plaintext ON credit_cards(id) WHERE ciphertext IS NULL;
+
+COMMIT;
\ No newline at end of file
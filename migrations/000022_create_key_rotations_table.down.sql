@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_credit_cards_key_id;
+DROP TABLE IF EXISTS key_rotations;
+
+COMMIT;
\ No newline at end of file
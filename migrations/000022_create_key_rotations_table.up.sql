@@ -0,0 +1,15 @@
+BEGIN;
+
+-- progress of rotate-keys, one row per master key cards are rotated to
+CREATE TABLE IF NOT EXISTS key_rotations (
+    key_id VARCHAR(50) PRIMARY KEY,
+    last_card_id BIGINT NOT NULL DEFAULT 0,
+    rotated BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_credit_cards_key_id ON credit_cards(key_id);
+
+COMMIT;
\ No newline at end of file
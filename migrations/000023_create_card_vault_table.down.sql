@@ -0,0 +1,17 @@
+BEGIN;
+
+ALTER TABLE key_rotations RENAME COLUMN last_entry_id TO last_card_id;
+TRUNCATE key_rotations;
+
+DROP INDEX IF EXISTS idx_credit_cards_untokenized;
+CREATE INDEX IF NOT EXISTS idx_credit_cards_key_id ON credit_cards(key_id);
+CREATE INDEX IF NOT EXISTS idx_credit_cards_plaintext ON credit_cards(id) WHERE ciphertext IS NULL;
+
+-- scrubbed CVVs and numbers moved to the vault are not brought back
+ALTER TABLE credit_cards ADD COLUMN cvv VARCHAR(10);
+ALTER TABLE credit_cards DROP COLUMN last4;
+ALTER TABLE credit_cards DROP COLUMN token;
+
+DROP TABLE IF EXISTS card_vault;
+
+COMMIT;
\ No newline at end of file
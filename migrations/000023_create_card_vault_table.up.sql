@@ -0,0 +1,34 @@
+BEGIN;
+
+-- the vault holds the only copy of each card number, sealed under the card
+-- master key and referred to from credit_cards by an opaque token
+CREATE TABLE IF NOT EXISTS card_vault (
+    id BIGSERIAL PRIMARY KEY,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    key_id VARCHAR(50) NOT NULL,
+    data_key BYTEA NOT NULL,
+    nonce BYTEA NOT NULL,
+    ciphertext BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_card_vault_key_id ON card_vault(key_id);
+
+ALTER TABLE credit_cards ADD COLUMN token VARCHAR(64);
+ALTER TABLE credit_cards ADD COLUMN last4 CHAR(4);
+
+-- the CVV created with the table in 000002 must not be kept after
+-- authorization: scrub it once, then drop the column. CVVs sealed along with
+-- the number are dropped when the application moves those cards to the vault.
+UPDATE credit_cards SET cvv = NULL WHERE cvv IS NOT NULL;
+ALTER TABLE credit_cards DROP COLUMN cvv;
+
+DROP INDEX IF EXISTS idx_credit_cards_plaintext;
+DROP INDEX IF EXISTS idx_credit_cards_key_id;
+CREATE INDEX IF NOT EXISTS idx_credit_cards_untokenized ON credit_cards(id) WHERE token IS NULL;
+
+-- rotation walks the vault from now on, progress through credit_cards is void
+TRUNCATE key_rotations;
+ALTER TABLE key_rotations RENAME COLUMN last_card_id TO last_entry_id;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_credit_cards_default;
+DROP INDEX IF EXISTS idx_credit_cards_user_id;
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS is_default;
+
+-- fails while a user holds more than one card
+ALTER TABLE credit_cards ADD CONSTRAINT credit_cards_user_id_key UNIQUE (user_id);
+
+COMMIT;
\ No newline at end of file
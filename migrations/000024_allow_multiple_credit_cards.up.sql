@@ -0,0 +1,13 @@
+BEGIN;
+
+-- a user can hold several cards, one of which is their default
+ALTER TABLE credit_cards DROP CONSTRAINT IF EXISTS credit_cards_user_id_key;
+ALTER TABLE credit_cards ADD COLUMN is_default BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- the one card each user had so far becomes their default
+UPDATE credit_cards SET is_default = TRUE WHERE user_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_credit_cards_user_id ON credit_cards(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_credit_cards_default ON credit_cards(user_id) WHERE is_default;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+-- the spelling submitted before is not kept, so there is nothing to restore
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- card types are the brand names of the BIN table from now on
+UPDATE credit_cards SET type = 'amex' WHERE LOWER(TRIM(type)) = 'american express';
+UPDATE credit_cards SET type = LOWER(TRIM(type)) WHERE type <> LOWER(TRIM(type));
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE user_history DROP COLUMN actor_id;
+ALTER TABLE user_history DROP COLUMN actor_type;
+
+COMMIT;
\ No newline at end of file
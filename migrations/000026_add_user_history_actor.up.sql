@@ -0,0 +1,7 @@
+BEGIN;
+
+-- who made each change; entries recorded before stay without an actor
+ALTER TABLE user_history ADD COLUMN actor_type VARCHAR(10) CHECK (actor_type IN ('api_key', 'user', 'anonymous', 'system'));
+ALTER TABLE user_history ADD COLUMN actor_id BIGINT;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+-- the public key is not brought back
+
+COMMIT;
\ No newline at end of file
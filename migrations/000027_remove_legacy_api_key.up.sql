@@ -0,0 +1,8 @@
+BEGIN;
+
+-- the key formerly compiled into the binary was public, drop it where an
+-- earlier version of 000013 stored it. Operators still relying on it can
+-- import it read-only with create-key -legacy.
+DELETE FROM api_keys WHERE key_hash = 'ed7d6a91e10e2bfc088e6034f7993fd0c9189392ba0da3102a97b2d5947eeffc';
+
+COMMIT;
\ No newline at end of file
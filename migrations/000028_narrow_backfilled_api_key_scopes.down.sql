@@ -0,0 +1,5 @@
+BEGIN;
+
+-- the granted scopes are not brought back
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,15 @@
+BEGIN;
+
+-- earlier versions of 000014, 000017, 000019 and 000020 granted every key
+-- that existed before scopes keys:manage and then users:admin, the admin
+-- role and audit:read. Keys not created through the admin API go back to
+-- the user routes they could call before scopes.
+UPDATE api_keys k SET
+    role = NULL,
+    scopes = ARRAY(SELECT s FROM unnest(k.scopes) s WHERE s IN ('users:read', 'users:write', 'users:register', 'cards:read_masked'))
+WHERE NOT EXISTS (
+    SELECT 1 FROM audit_events e
+    WHERE e.action = 'api_key.created' AND e.target_type = 'api_key' AND e.target_id = k.id
+);
+
+COMMIT;
\ No newline at end of file
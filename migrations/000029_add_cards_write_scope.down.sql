@@ -0,0 +1,5 @@
+BEGIN;
+
+UPDATE api_keys SET scopes = array_remove(scopes, 'cards:write');
+
+COMMIT;
\ No newline at end of file
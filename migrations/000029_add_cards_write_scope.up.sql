@@ -0,0 +1,9 @@
+BEGIN;
+
+-- adding, changing and deleting cards needs cards:write from now on, which
+-- only the admin role allows. Admin keys that could edit users keep
+-- editing cards.
+UPDATE api_keys SET scopes = array_append(scopes, 'cards:write')
+WHERE role = 'admin' AND 'users:write' = ANY(scopes) AND NOT 'cards:write' = ANY(scopes);
+
+COMMIT;
\ No newline at end of file